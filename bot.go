@@ -2,7 +2,12 @@ package icqbotapi
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mailru/easyjson"
@@ -30,7 +35,21 @@ type pinMessageHandlerFunc func(e event.MessagePinPayload)
 type unpinMessageHandlerFunc func(e event.MessageUnpinPayload)
 type newChatMembersHandlerFunc func(e event.NewChatMembersPayload)
 type leftChatMembersHandlerFunc func(e event.LeftChatMembersPayload)
+type callbackQueryHandlerFunc func(e event.CallbackQueryPayload)
 type errorHandlerFunc func(err error)
+type eventHandlerFunc func(e event.Event, payload interface{})
+type unknownEventHandlerFunc func(e event.Event)
+
+type newMessageContextHandlerFunc func(ctx context.Context, b *Bot, e event.NewMessagePayload) error
+type editMessageContextHandlerFunc func(ctx context.Context, b *Bot, e event.MessageEditPayload) error
+type deleteMessageContextHandlerFunc func(ctx context.Context, b *Bot, e event.MessageDeletePayload) error
+type pinMessageContextHandlerFunc func(ctx context.Context, b *Bot, e event.MessagePinPayload) error
+type unpinMessageContextHandlerFunc func(ctx context.Context, b *Bot, e event.MessageUnpinPayload) error
+type newChatMembersContextHandlerFunc func(ctx context.Context, b *Bot, e event.NewChatMembersPayload) error
+type leftChatMembersContextHandlerFunc func(ctx context.Context, b *Bot, e event.LeftChatMembersPayload) error
+type callbackQueryContextHandlerFunc func(ctx context.Context, b *Bot, e event.CallbackQueryPayload) error
+type eventContextHandlerFunc func(ctx context.Context, b *Bot, e event.Event, payload interface{}) error
+type unknownEventContextHandlerFunc func(ctx context.Context, b *Bot, e event.Event) error
 
 type botState int
 
@@ -41,43 +60,85 @@ const (
 )
 
 type botHandlers struct {
-	newMessageHandler    newMessageHandlerFunc
-	editMessageHandler   editMessageHandlerFunc
-	deleteMessageHandler deleteMessageHandlerFunc
+	newMessageHandler    newMessageContextHandlerFunc
+	editMessageHandler   editMessageContextHandlerFunc
+	deleteMessageHandler deleteMessageContextHandlerFunc
 
-	pinMessageHandler   pinMessageHandlerFunc
-	unpinMessageHandler unpinMessageHandlerFunc
+	pinMessageHandler   pinMessageContextHandlerFunc
+	unpinMessageHandler unpinMessageContextHandlerFunc
 
-	newChatMemberHandler   newChatMembersHandlerFunc
-	leftChatMembersHandler leftChatMembersHandlerFunc
+	newChatMemberHandler   newChatMembersContextHandlerFunc
+	leftChatMembersHandler leftChatMembersContextHandlerFunc
+
+	callbackQueryHandler callbackQueryContextHandlerFunc
+
+	eventHandlers       map[event.Kind]eventContextHandlerFunc
+	unknownEventHandler unknownEventContextHandlerFunc
 
 	errorHandler errorHandlerFunc
 }
 
 type Bot struct {
+	mu    sync.Mutex
 	state botState
+	run   *botRun
 
 	token        string
 	apiBaseURL   string
+	userAgent    string
 	client       *http.Client
 	pollDuration time.Duration
+	retryPolicy  RetryPolicy
+	limiter      RateLimiter
+	logger       Logger
+	offsets      OffsetStore
 	handlers     botHandlers
+
+	// deadLetterHandler receives failed events, which are committed afterwards.
+	deadLetterHandler func(ctx context.Context, ev event.Event, err error)
+
+	middlewares     []Middleware
+	kindMiddlewares map[event.Kind][]Middleware
+
+	webhookMode bool
+	webhook     webhookInbox
+
+	concurrency     int
+	queueSize       int
+	shutdownTimeout time.Duration
+	maxUploadSize   int64
+	maxDownloadSize int64
+	uploadCache     UploadCache
 }
 
 // New creates new instance of Bot
 func New(token string, client *http.Client, t apiType) *Bot {
-	apiBaseURL := icqAPIBaseURL
-	if t == APITypeAgent {
-		apiBaseURL = agentAPIBaseURL
-	}
+	return NewWithOptions(token, WithHTTPClient(client), WithAPIType(t))
+}
 
-	return &Bot{
+// NewWithOptions creates new instance of Bot configured with options.
+// By default the bot uses ICQ API, http.DefaultClient, DefaultRetryPolicy
+// and writes info and higher level records to the standard error.
+func NewWithOptions(token string, opts ...Option) *Bot {
+	b := &Bot{
 		state:        botStateStopped,
 		token:        token,
-		apiBaseURL:   apiBaseURL,
-		client:       client,
+		apiBaseURL:   icqAPIBaseURL,
+		client:       http.DefaultClient,
 		pollDuration: time.Minute,
+		retryPolicy:  DefaultRetryPolicy,
+		logger:       NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LogLevelInfo),
+
+		concurrency:     defaultConcurrency,
+		queueSize:       defaultQueueSize,
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(b)
 	}
+
+	return b
 }
 
 //easyjson:json
@@ -93,6 +154,10 @@ type GetSelfResponse struct {
 	Ok bool `json:"ok"`
 }
 
+func (r GetSelfResponse) status() (bool, string) {
+	return r.Ok, ""
+}
+
 // GetSelf returns information about Bot.
 // It can be used to validate API token.
 func (b *Bot) GetSelf(ctx context.Context) (*GetSelfResponse, error) {
@@ -109,8 +174,10 @@ func (b *Bot) GetSelf(ctx context.Context) (*GetSelfResponse, error) {
 		return nil, err
 	}
 
+	defer httpResp.Body.Close()
+
 	resp := &GetSelfResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -124,137 +191,437 @@ func (b *Bot) doRequest(ctx context.Context, r *http.Request) (*http.Response, e
 	q.Add(tokenQueryParam, b.token)
 	r.URL.RawQuery = q.Encode()
 
-	return b.client.Do(r)
+	if b.userAgent != "" {
+		r.Header.Set("User-Agent", b.userAgent)
+	}
+
+	return b.doRequestWithRetry(ctx, r)
+}
+
+// statusReporter is implemented by responses which carry the status of API call.
+type statusReporter interface {
+	status() (ok bool, description string)
+}
+
+// decodeResponse unmarshals the response body into v.
+// It returns *APIError if the server responded with non-2xx status code or reported the failure in the body.
+func (b *Bot) decodeResponse(httpResp *http.Response, v easyjson.Unmarshaler) error {
+	method := b.apiMethod(httpResp.Request)
+
+	if httpResp.StatusCode < http.StatusOK || httpResp.StatusCode >= http.StatusMultipleChoices {
+		s := StatusResponse{}
+		// the body of failed response is not guaranteed to be json, so the description is best-effort.
+		_ = easyjson.UnmarshalFromReader(httpResp.Body, &s)
+
+		apiErr := newAPIError(method, httpResp.StatusCode, s.Description.V)
+		apiErr.RetryAfter, _ = parseRetryAfter(httpResp.Header.Get("Retry-After"))
+
+		return apiErr
+	}
+
+	if err := easyjson.UnmarshalFromReader(httpResp.Body, v); err != nil {
+		return err
+	}
+
+	if s, ok := v.(statusReporter); ok {
+		if ok, description := s.status(); !ok {
+			return newAPIError(method, httpResp.StatusCode, description)
+		}
+	}
+
+	return nil
+}
+
+// apiMethod returns the API method path of the request, e.g. "/messages/sendText".
+func (b *Bot) apiMethod(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	base, err := url.Parse(b.apiBaseURL)
+	if err != nil {
+		return r.URL.Path
+	}
+
+	return strings.TrimPrefix(r.URL.Path, base.Path)
 }
 
 // SetNewMessageHandler sets the handler to events about new message.
+// It replaces the handler set with SetNewMessageContextHandler.
 func (b *Bot) SetNewMessageHandler(fn newMessageHandlerFunc) {
+	if fn == nil {
+		b.handlers.newMessageHandler = nil
+		return
+	}
+
+	b.handlers.newMessageHandler = func(_ context.Context, _ *Bot, e event.NewMessagePayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetNewMessageContextHandler sets the handler to events about new message, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetNewMessageHandler.
+func (b *Bot) SetNewMessageContextHandler(fn newMessageContextHandlerFunc) {
 	b.handlers.newMessageHandler = fn
 }
 
 // SetEditMessageHandler sets the handler to events about edit message.
+// It replaces the handler set with SetEditMessageContextHandler.
 func (b *Bot) SetEditMessageHandler(fn editMessageHandlerFunc) {
+	if fn == nil {
+		b.handlers.editMessageHandler = nil
+		return
+	}
+
+	b.handlers.editMessageHandler = func(_ context.Context, _ *Bot, e event.MessageEditPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetEditMessageContextHandler sets the handler to events about edit message, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetEditMessageHandler.
+func (b *Bot) SetEditMessageContextHandler(fn editMessageContextHandlerFunc) {
 	b.handlers.editMessageHandler = fn
 }
 
-// sets the handler to events about delete message.
+// SetDeleteMessageHandler sets the handler to events about delete message.
+// It replaces the handler set with SetDeleteMessageContextHandler.
 func (b *Bot) SetDeleteMessageHandler(fn deleteMessageHandlerFunc) {
+	if fn == nil {
+		b.handlers.deleteMessageHandler = nil
+		return
+	}
+
+	b.handlers.deleteMessageHandler = func(_ context.Context, _ *Bot, e event.MessageDeletePayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetDeleteMessageContextHandler sets the handler to events about delete message, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetDeleteMessageHandler.
+func (b *Bot) SetDeleteMessageContextHandler(fn deleteMessageContextHandlerFunc) {
 	b.handlers.deleteMessageHandler = fn
 }
 
-// sets the handler to events about pin message.
+// SetPinMessageHandler sets the handler to events about pin message.
+// It replaces the handler set with SetPinMessageContextHandler.
 func (b *Bot) SetPinMessageHandler(fn pinMessageHandlerFunc) {
+	if fn == nil {
+		b.handlers.pinMessageHandler = nil
+		return
+	}
+
+	b.handlers.pinMessageHandler = func(_ context.Context, _ *Bot, e event.MessagePinPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetPinMessageContextHandler sets the handler to events about pin message, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetPinMessageHandler.
+func (b *Bot) SetPinMessageContextHandler(fn pinMessageContextHandlerFunc) {
 	b.handlers.pinMessageHandler = fn
 }
 
 // SetUnpinMessageHandler sets the handler to events about unpin message.
+// It replaces the handler set with SetUnpinMessageContextHandler.
 func (b *Bot) SetUnpinMessageHandler(fn unpinMessageHandlerFunc) {
+	if fn == nil {
+		b.handlers.unpinMessageHandler = nil
+		return
+	}
+
+	b.handlers.unpinMessageHandler = func(_ context.Context, _ *Bot, e event.MessageUnpinPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetUnpinMessageContextHandler sets the handler to events about unpin message, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetUnpinMessageHandler.
+func (b *Bot) SetUnpinMessageContextHandler(fn unpinMessageContextHandlerFunc) {
 	b.handlers.unpinMessageHandler = fn
 }
 
 // SetNewChatMemberHandler sets the handler to events about new chat member.
+// It replaces the handler set with SetNewChatMemberContextHandler.
 func (b *Bot) SetNewChatMemberHandler(fn newChatMembersHandlerFunc) {
+	if fn == nil {
+		b.handlers.newChatMemberHandler = nil
+		return
+	}
+
+	b.handlers.newChatMemberHandler = func(_ context.Context, _ *Bot, e event.NewChatMembersPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetNewChatMemberContextHandler sets the handler to events about new chat member, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetNewChatMemberHandler.
+func (b *Bot) SetNewChatMemberContextHandler(fn newChatMembersContextHandlerFunc) {
 	b.handlers.newChatMemberHandler = fn
 }
 
 // SetLeftChatMemberHandler sets the handler to events about left chat member.
+// It replaces the handler set with SetLeftChatMemberContextHandler.
 func (b *Bot) SetLeftChatMemberHandler(fn leftChatMembersHandlerFunc) {
+	if fn == nil {
+		b.handlers.leftChatMembersHandler = nil
+		return
+	}
+
+	b.handlers.leftChatMembersHandler = func(_ context.Context, _ *Bot, e event.LeftChatMembersPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetLeftChatMemberContextHandler sets the handler to events about left chat member, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetLeftChatMemberHandler.
+func (b *Bot) SetLeftChatMemberContextHandler(fn leftChatMembersContextHandlerFunc) {
 	b.handlers.leftChatMembersHandler = fn
 }
 
+// SetCallbackQueryHandler sets the handler to events about pressed inline keyboard buttons.
+// It replaces the handler set with SetCallbackQueryContextHandler.
+func (b *Bot) SetCallbackQueryHandler(fn callbackQueryHandlerFunc) {
+	if fn == nil {
+		b.handlers.callbackQueryHandler = nil
+		return
+	}
+
+	b.handlers.callbackQueryHandler = func(_ context.Context, _ *Bot, e event.CallbackQueryPayload) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetCallbackQueryContextHandler sets the handler to events about pressed inline keyboard buttons, which receives
+// the context canceled on shutdown. The returned error is reported to the error handler.
+// It replaces the handler set with SetCallbackQueryHandler.
+func (b *Bot) SetCallbackQueryContextHandler(fn callbackQueryContextHandlerFunc) {
+	b.handlers.callbackQueryHandler = fn
+}
+
+// SetEventHandler sets the handler to events of the kind, e.g. the custom kind which has no dedicated handler setter.
+// The handler of the built-in kind receives its events only while the dedicated handler, e.g. SetNewMessageHandler, is not set.
+// The handler receives the payload decoded by the decoder registered with event.RegisterDecoder
+// or the raw payload if there is no decoder.
+// It replaces the handler set with SetEventContextHandler.
+func (b *Bot) SetEventHandler(kind event.Kind, fn eventHandlerFunc) {
+	if fn == nil {
+		b.SetEventContextHandler(kind, nil)
+		return
+	}
+
+	b.SetEventContextHandler(kind, func(_ context.Context, _ *Bot, e event.Event, payload interface{}) error {
+		fn(e, payload)
+		return nil
+	})
+}
+
+// SetEventContextHandler sets the handler to events of the kind like SetEventHandler,
+// which receives the context canceled on shutdown. The returned error is reported to the error handler.
+func (b *Bot) SetEventContextHandler(kind event.Kind, fn eventContextHandlerFunc) {
+	if fn == nil {
+		delete(b.handlers.eventHandlers, kind)
+		return
+	}
+
+	if b.handlers.eventHandlers == nil {
+		b.handlers.eventHandlers = make(map[event.Kind]eventContextHandlerFunc)
+	}
+
+	b.handlers.eventHandlers[kind] = fn
+}
+
+// SetUnknownEventHandler sets the handler to events of kinds which have no handler set,
+// neither the dedicated one nor with SetEventHandler, e.g. new kinds added to the API after the library release.
+// It replaces the handler set with SetUnknownEventContextHandler.
+func (b *Bot) SetUnknownEventHandler(fn unknownEventHandlerFunc) {
+	if fn == nil {
+		b.handlers.unknownEventHandler = nil
+		return
+	}
+
+	b.handlers.unknownEventHandler = func(_ context.Context, _ *Bot, e event.Event) error {
+		fn(e)
+		return nil
+	}
+}
+
+// SetUnknownEventContextHandler sets the handler to events of kinds which have no handler set
+// like SetUnknownEventHandler, which receives the context canceled on shutdown.
+// The returned error is reported to the error handler.
+func (b *Bot) SetUnknownEventContextHandler(fn unknownEventContextHandlerFunc) {
+	b.handlers.unknownEventHandler = fn
+}
+
 // SetErrorHandler sets the processing errors handler.
 func (b *Bot) SetErrorHandler(fn errorHandlerFunc) {
 	b.handlers.errorHandler = fn
 }
 
-func (b *Bot) unmarshalEvent(p []byte, v easyjson.Unmarshaler) bool {
-	if err := easyjson.Unmarshal(p, v); err != nil {
-		b.handleError(err)
-		return false
-	}
-
-	return true
+func (b *Bot) unmarshalEvent(r event.Event, v easyjson.Unmarshaler) error {
+	return easyjson.Unmarshal(r.Payload, v)
 }
 
-func (b *Bot) handleNewMessage(r event.Event) {
+func (b *Bot) handleNewMessage(ctx context.Context, r event.Event) error {
 	if b.handlers.newMessageHandler != nil {
 		e := event.NewMessagePayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.newMessageHandler(e)
+		return b.handlers.newMessageHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handleEditMessage(r event.Event) {
+func (b *Bot) handleEditMessage(ctx context.Context, r event.Event) error {
 	if b.handlers.editMessageHandler != nil {
 		e := event.MessageEditPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.editMessageHandler(e)
+		return b.handlers.editMessageHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handleDeleteMessage(r event.Event) {
+func (b *Bot) handleDeleteMessage(ctx context.Context, r event.Event) error {
 	if b.handlers.deleteMessageHandler != nil {
-		e := event.MessageEditPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		e := event.MessageDeletePayload{}
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.editMessageHandler(e)
+		return b.handlers.deleteMessageHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handlePinMessage(r event.Event) {
+func (b *Bot) handlePinMessage(ctx context.Context, r event.Event) error {
 	if b.handlers.pinMessageHandler != nil {
 		e := event.MessagePinPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.pinMessageHandler(e)
+		return b.handlers.pinMessageHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handleUnpinMessage(r event.Event) {
+func (b *Bot) handleUnpinMessage(ctx context.Context, r event.Event) error {
 	if b.handlers.unpinMessageHandler != nil {
 		e := event.MessageUnpinPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.unpinMessageHandler(e)
+		return b.handlers.unpinMessageHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handleNewChatMember(r event.Event) {
+func (b *Bot) handleNewChatMember(ctx context.Context, r event.Event) error {
 	if b.handlers.newChatMemberHandler != nil {
 		e := event.NewChatMembersPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.newChatMemberHandler(e)
+		return b.handlers.newChatMemberHandler(ctx, b, e)
 	}
+
+	return nil
 }
 
-func (b *Bot) handleLeftChatMember(r event.Event) {
+func (b *Bot) handleLeftChatMember(ctx context.Context, r event.Event) error {
 	if b.handlers.leftChatMembersHandler != nil {
 		e := event.LeftChatMembersPayload{}
-		if !b.unmarshalEvent(r.Payload, &e) {
-			return
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
+		}
+
+		return b.handlers.leftChatMembersHandler(ctx, b, e)
+	}
+
+	return nil
+}
+
+func (b *Bot) handleCallbackQuery(ctx context.Context, r event.Event) error {
+	if b.handlers.callbackQueryHandler != nil {
+		e := event.CallbackQueryPayload{}
+		if err := b.unmarshalEvent(r, &e); err != nil {
+			return err
 		}
 
-		b.handlers.leftChatMembersHandler(e)
+		return b.handlers.callbackQueryHandler(ctx, b, e)
 	}
+
+	return nil
+}
+
+func (b *Bot) handleCustomEvent(ctx context.Context, r event.Event) error {
+	if fn, ok := b.handlers.eventHandlers[r.Type]; ok {
+		var payload interface{} = r.Payload
+
+		if event.IsKnown(r.Type) {
+			p, err := r.Decode()
+			if err != nil {
+				return err
+			}
+
+			payload = p
+		}
+
+		return fn(ctx, b, r, payload)
+	}
+
+	if b.handlers.unknownEventHandler != nil {
+		return b.handlers.unknownEventHandler(ctx, b, r)
+	}
+
+	// events of known kinds without the handler are skipped silently.
+	if !event.IsKnown(r.Type) {
+		b.logger.Log(LogLevelWarn, "unexpected event kind",
+			LogField{LogKeyEventID, r.EventID},
+			LogField{LogKeyEventKind, r.Type},
+		)
+	}
+
+	return nil
 }
 
 func (b *Bot) handleError(err error) {
-	if b.handlers.errorHandler != nil {
-		b.handlers.errorHandler(err)
+	if b.handlers.errorHandler == nil {
+		return
 	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			b.logger.Log(LogLevelError, "error handler panicked", LogField{LogKeyError, newPanicError(v, nil)})
+		}
+	}()
+
+	b.handlers.errorHandler(err)
 }
@@ -2,25 +2,133 @@ package icqbotapi
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"testing"
 	"time"
 
 	"icqbotapi/event"
+	"icqbotapi/icqtest"
 )
 
 func TestBot_GetSelf(t *testing.T) {
-	const token = "001.1104030426.1757333006:757143498"
-	bot := New(token, http.DefaultClient, APITypeICQ)
+	srv := icqtest.NewServer()
+	defer srv.Close()
+
+	srv.SetSelf(icqtest.Self{UserID: "1", Nick: "testbot"})
+
+	bot := NewWithOptions(srv.Token, WithBaseURL(srv.URL()), WithHTTPClient(srv.Client()))
 
 	r, err := bot.GetSelf(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !r.Ok {
-		t.Fatal("unexpected response status")
+	if !r.Ok || r.UserID != "1" || r.Nick != "testbot" {
+		t.Fatalf("unexpected response: %+v", r)
+	}
+}
+
+func TestBot_dispatchUnknownEvent(t *testing.T) {
+	bot := NewWithOptions("token", WithLogger(NopLogger))
+
+	var (
+		custom  interface{}
+		unknown event.Event
+	)
+
+	bot.SetEventHandler("customKind", func(e event.Event, payload interface{}) {
+		custom = payload
+	})
+
+	bot.SetUnknownEventHandler(func(e event.Event) {
+		unknown = e
+	})
+
+	if err := bot.dispatch(context.Background(), event.Event{EventID: 1, Type: "customKind", Payload: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := custom.(json.RawMessage); !ok || string(p) != "{}" {
+		t.Fatalf("unexpected custom payload: %#v", custom)
+	}
+
+	if err := bot.dispatch(context.Background(), event.Event{EventID: 2, Type: "futureKind", Payload: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if unknown.EventID != 2 || string(unknown.Payload) != "{}" {
+		t.Fatalf("unexpected unknown event: %#v", unknown)
+	}
+}
+
+func TestBot_dispatchBuiltinKindWithoutHandler(t *testing.T) {
+	bot := NewWithOptions("token", WithLogger(NopLogger))
+
+	var (
+		generic interface{}
+		unknown event.Event
+	)
+
+	bot.SetEventHandler(event.KindPinnedMessage, func(e event.Event, payload interface{}) {
+		generic = payload
+	})
+
+	bot.SetUnknownEventHandler(func(e event.Event) {
+		unknown = e
+	})
+
+	pinned := event.Event{EventID: 1, Type: event.KindPinnedMessage, Payload: []byte(`{"msgId": "1"}`)}
+	if err := bot.dispatch(context.Background(), pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := generic.(event.MessagePinPayload); !ok || p.MessageID != "1" {
+		t.Fatalf("unexpected payload of the built-in kind: %#v", generic)
+	}
+
+	edited := event.Event{EventID: 2, Type: event.KindEditedMessage, Payload: []byte(`{}`)}
+	if err := bot.dispatch(context.Background(), edited); err != nil {
+		t.Fatal(err)
+	}
+
+	if unknown.EventID != 2 {
+		t.Fatalf("built-in kind without handler is not passed to the unknown event handler: %#v", unknown)
+	}
+
+	// the dedicated handler takes precedence.
+	var dedicated bool
+
+	bot.SetPinMessageHandler(func(e event.MessagePinPayload) {
+		dedicated = true
+	})
+
+	generic = nil
+	if err := bot.dispatch(context.Background(), pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	if !dedicated || generic != nil {
+		t.Fatalf("dedicated handler is not preferred: %v, %#v", dedicated, generic)
+	}
+
+	// the handler set to nil is removed, so the event falls back to the generic one.
+	bot.SetPinMessageHandler(nil)
+
+	if err := bot.dispatch(context.Background(), pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := generic.(event.MessagePinPayload); !ok {
+		t.Fatalf("event is not passed to the generic handler: %#v", generic)
+	}
+
+	bot.SetEventHandler(event.KindPinnedMessage, nil)
+	bot.SetUnknownEventHandler(nil)
+
+	if err := bot.dispatch(context.Background(), pinned); err != nil {
+		t.Fatal(err)
 	}
 }
 
@@ -4,8 +4,6 @@ import (
 	"context"
 	"net/http"
 	"net/url"
-
-	"github.com/mailru/easyjson"
 )
 
 //easyjson:json
@@ -19,11 +17,10 @@ type Admin struct {
 type ChatID string
 
 func (c ChatID) validate() error {
-	if c == "" {
-		return errValidation
-	}
+	v := &validator{}
+	v.check(c != "", "ChatID", "is required")
 
-	return nil
+	return v.err()
 }
 
 func (c ChatID) contributeToQuery(q url.Values) {
@@ -59,7 +56,7 @@ func (b *Bot) GetChatAdmins(ctx context.Context, r ChatID) (*GetAdminsResponse,
 		Admins: make([]Admin, 0),
 	}
 
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +98,7 @@ func (b *Bot) GetChatInfo(ctx context.Context, r ChatID) (*ChatInfoResponse, err
 	defer httpResp.Body.Close()
 
 	resp := &ChatInfoResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +168,11 @@ func (b *Bot) SendChatActions(ctx context.Context, reqs <-chan ChatActionsReques
 					continue
 				}
 
+				err = b.decodeResponse(httpResp, &StatusResponse{})
 				httpResp.Body.Close()
+				if err != nil {
+					b.handleError(err)
+				}
 			}
 		}
 	}()
@@ -2,10 +2,13 @@ package icqbotapi
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"testing"
 	"time"
+
+	"icqbotapi/icqtest"
 )
 
 func ExampleBot_GetChatAdmins() {
@@ -17,12 +20,22 @@ func ExampleBot_GetChatAdmins() {
 	log.Printf("%#v", data)
 }
 
-func TestName(t *testing.T) {
-	const token = "001.1104030426.1757333006:757143498"
-	bot := New(token, http.DefaultClient, APITypeICQ)
-	events := make(chan ChatActionsRequest)
+func TestBot_SendChatActions(t *testing.T) {
+	srv := icqtest.NewServer()
+	defer srv.Close()
 
-	bot.SendChatActions(context.Background(), events)
+	bot := NewWithOptions(srv.Token, WithBaseURL(srv.URL()), WithHTTPClient(srv.Client()))
+
+	errs := make(chan error, 1)
+	bot.SetErrorHandler(func(err error) {
+		errs <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reqs := make(chan ChatActionsRequest)
+	bot.SendChatActions(ctx, reqs)
 
 	chats := []ChatID{
 		"chat1",
@@ -30,18 +43,39 @@ func TestName(t *testing.T) {
 		"chat3",
 	}
 
-	for i := 0; i < 50; i++ {
-		events <- ChatActionsRequest{
-			ChatID: chats[i%len(chats)],
+	for _, chatID := range chats {
+		reqs <- ChatActionsRequest{
+			ChatID: chatID,
 			Actions: []ChatAction{
 				ChatActionTyping,
 			},
 		}
+	}
+
+	// the invalid request is reported to the error handler.
+	reqs <- ChatActionsRequest{}
 
-		time.Sleep(time.Millisecond * 500)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrValidation) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("invalid request is not reported")
 	}
 
-	close(events)
+	close(reqs)
+
+	sent := srv.RequestsTo("/chats/sendActions")
+	if len(sent) != len(chats) {
+		t.Fatalf("unexpected requests: %+v", sent)
+	}
+
+	for i, r := range sent {
+		if r.Query.Get("chatId") != string(chats[i]) || r.Query.Get("actions") != string(ChatActionTyping) {
+			t.Fatalf("unexpected request: %v", r.Query)
+		}
+	}
 }
 
 func ExampleBot_SendChatActions() {
@@ -0,0 +1,238 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"icqbotapi/event"
+)
+
+// ConversationEnd is the state returned by the conversation handler to end the conversation.
+const ConversationEnd = ""
+
+var (
+	// ErrUnknownState is returned when the conversation moves to the state without handler.
+	ErrUnknownState = errors.New("unknown conversation state")
+	// ErrInvalidTransition is returned when the conversation handler returns the state not declared as its transition.
+	ErrInvalidTransition = errors.New("invalid conversation state transition")
+)
+
+// ConversationInput represents the input of the user in the conversation,
+// which is either the new message or the pressed inline keyboard button.
+type ConversationInput struct {
+	Message       *event.NewMessagePayload
+	CallbackQuery *event.CallbackQueryPayload
+}
+
+// ConversationHandlerFunc handles the input of the user in the state of the conversation.
+// It may change the data of the session and returns the next state, the current one to stay
+// in it or ConversationEnd to end the conversation.
+type ConversationHandlerFunc func(ctx context.Context, b *Bot, s *Session, in ConversationInput) (string, error)
+
+type conversationState struct {
+	handler     ConversationHandlerFunc
+	transitions map[string]bool
+}
+
+// Conversation is the state machine of multi-step dialogs with the user in the chat.
+// The conversation is started with Begin and receives the following input of the user
+// through the middleware added to the bot with Use. Input of users without the conversation
+// is passed to the bot handlers as usual.
+// States must be declared before the bot starts handling events.
+type Conversation struct {
+	store   SessionStore
+	timeout time.Duration
+	states  map[string]*conversationState
+	now     func() time.Time
+
+	sweepMu   sync.Mutex
+	lastSweep time.Time
+}
+
+// NewConversation creates the conversation keeping sessions in the store.
+func NewConversation(store SessionStore) *Conversation {
+	return &Conversation{
+		store:  store,
+		states: make(map[string]*conversationState),
+		now:    time.Now,
+	}
+}
+
+// SetTimeout sets the time after the last input when the conversation expires.
+// Expired conversations are ended on the next input of the user. If the store is SessionExpirer,
+// expired sessions of all users are also deleted once per timeout when sessions are saved.
+// Zero timeout means no expiration.
+func (c *Conversation) SetTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// Handle declares the state with the handler and the states it can move to.
+// Staying in the state and ending the conversation are always allowed.
+func (c *Conversation) Handle(state string, fn ConversationHandlerFunc, transitions ...string) {
+	st := &conversationState{
+		handler:     fn,
+		transitions: map[string]bool{state: true, ConversationEnd: true},
+	}
+
+	for _, t := range transitions {
+		st.transitions[t] = true
+	}
+
+	c.states[state] = st
+}
+
+// Begin starts the conversation of the user in the chat from the state with empty data.
+// It replaces the conversation which is already in progress.
+func (c *Conversation) Begin(ctx context.Context, key SessionKey, state string) (*Session, error) {
+	if _, ok := c.states[state]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownState, state)
+	}
+
+	s := &Session{
+		State:     state,
+		Data:      make(map[string]string),
+		UpdatedAt: c.now(),
+	}
+
+	if err := c.save(ctx, key, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// End ends the conversation of the user in the chat.
+func (c *Conversation) End(ctx context.Context, key SessionKey) error {
+	return c.store.Delete(ctx, key)
+}
+
+// Session returns the session of the conversation in progress or nil if there is none.
+// The expired session is deleted.
+func (c *Conversation) Session(ctx context.Context, key SessionKey) (*Session, error) {
+	s, err := c.store.Load(ctx, key)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	if c.timeout > 0 && c.now().Sub(s.UpdatedAt) > c.timeout {
+		return nil, c.store.Delete(ctx, key)
+	}
+
+	if s.Data == nil {
+		s.Data = make(map[string]string)
+	}
+
+	return s, nil
+}
+
+// Middleware returns the middleware which passes new messages and callback queries
+// of users with the conversation in progress to the handler of its state.
+// Events of the same chat are handled in order, so the session is never changed concurrently.
+func (c *Conversation) Middleware() Middleware {
+	return func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev event.Event) error {
+			if ev.Type != event.KindNewMessage && ev.Type != event.KindCallbackQuery {
+				return next(ctx, ev)
+			}
+
+			key, in, err := conversationInput(ev)
+			if err != nil {
+				return err
+			}
+
+			s, err := c.Session(ctx, key)
+			if err != nil {
+				return err
+			}
+
+			if s == nil {
+				return next(ctx, ev)
+			}
+
+			b, _ := BotFromContext(ctx)
+
+			return c.handle(ctx, b, key, s, in)
+		}
+	}
+}
+
+func (c *Conversation) handle(ctx context.Context, b *Bot, key SessionKey, s *Session, in ConversationInput) error {
+	st, ok := c.states[s.State]
+	if !ok {
+		// the state may have been removed since the session was saved.
+		if err := c.store.Delete(ctx, key); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", ErrUnknownState, s.State)
+	}
+
+	next, err := st.handler(ctx, b, s, in)
+	if err != nil {
+		return err
+	}
+
+	if !st.transitions[next] {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, s.State, next)
+	}
+
+	if next == ConversationEnd {
+		return c.store.Delete(ctx, key)
+	}
+
+	if _, ok := c.states[next]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownState, next)
+	}
+
+	s.State = next
+	s.UpdatedAt = c.now()
+
+	return c.save(ctx, key, s)
+}
+
+// save saves the session and deletes expired sessions if the last sweep was more than the timeout ago.
+func (c *Conversation) save(ctx context.Context, key SessionKey, s *Session) error {
+	if err := c.store.Save(ctx, key, s); err != nil {
+		return err
+	}
+
+	e, ok := c.store.(SessionExpirer)
+	if !ok || c.timeout <= 0 {
+		return nil
+	}
+
+	now := c.now()
+
+	c.sweepMu.Lock()
+	sweep := now.Sub(c.lastSweep) >= c.timeout
+	if sweep {
+		c.lastSweep = now
+	}
+	c.sweepMu.Unlock()
+
+	if !sweep {
+		return nil
+	}
+
+	return e.DeleteExpired(ctx, now.Add(-c.timeout))
+}
+
+// conversationInput decodes the new message or the callback query and returns the key of its session.
+func conversationInput(ev event.Event) (SessionKey, ConversationInput, error) {
+	p, err := ev.Decode()
+	if err != nil {
+		return SessionKey{}, ConversationInput{}, err
+	}
+
+	switch e := p.(type) {
+	case event.NewMessagePayload:
+		return SessionKey{ChatID: e.Chat.ChatID, UserID: e.From.UserID}, ConversationInput{Message: &e}, nil
+	case event.CallbackQueryPayload:
+		return SessionKey{ChatID: e.Message.Chat.ChatID, UserID: e.From.UserID}, ConversationInput{CallbackQuery: &e}, nil
+	}
+
+	return SessionKey{}, ConversationInput{}, fmt.Errorf("unexpected payload %T", p)
+}
@@ -0,0 +1,161 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+)
+
+func TestConversation(t *testing.T) {
+	bot, done := newTestBot(nil)
+	defer done()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemorySessionStore()
+
+	conv := NewConversation(store)
+	conv.now = func() time.Time { return now }
+	conv.SetTimeout(time.Minute)
+
+	conv.Handle("title", func(ctx context.Context, b *Bot, s *Session, in ConversationInput) (string, error) {
+		s.Data["title"] = in.Message.Text
+		return "severity", nil
+	}, "severity")
+	conv.Handle("severity", func(ctx context.Context, b *Bot, s *Session, in ConversationInput) (string, error) {
+		if in.CallbackQuery == nil {
+			return "severity", nil
+		}
+
+		s.Data["severity"] = in.CallbackQuery.CallbackData
+
+		return "confirm", nil
+	}, "confirm")
+	conv.Handle("confirm", func(ctx context.Context, b *Bot, s *Session, in ConversationInput) (string, error) {
+		if in.Message.Text == "back" {
+			// the transition is not declared.
+			return "title", nil
+		}
+
+		return ConversationEnd, nil
+	})
+
+	bot.Use(conv.Middleware())
+
+	var passed []string
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		passed = append(passed, e.Text)
+	})
+
+	key := SessionKey{ChatID: "chat1", UserID: "user1"}
+	ctx := context.Background()
+
+	message := func(text string) error {
+		return bot.dispatch(ctx, event.Event{Type: event.KindNewMessage, Payload: []byte(
+			`{"chat": {"chatId": "chat1"}, "from": {"userId": "user1"}, "text": "` + text + `"}`)})
+	}
+
+	if err := message("hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conv.Begin(ctx, key, "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := message("outage"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bot.dispatch(ctx, event.Event{Type: event.KindCallbackQuery, Payload: []byte(
+		`{"queryId": "q1", "from": {"userId": "user1"}, "message": {"chat": {"chatId": "chat1"}}, "callbackData": "high"}`,
+	)}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := conv.Session(ctx, key)
+	if err != nil || s == nil {
+		t.Fatalf("unexpected session: %v, %v", s, err)
+	}
+
+	if s.State != "confirm" || s.Data["title"] != "outage" || s.Data["severity"] != "high" {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+
+	if err := message("back"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := message("yes"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := conv.Session(ctx, key); s != nil {
+		t.Fatalf("conversation is not ended: %+v", s)
+	}
+
+	if len(passed) != 1 || passed[0] != "hi" {
+		t.Fatalf("unexpected messages passed to the handler: %v", passed)
+	}
+}
+
+func TestConversation_timeout(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	conv := NewConversation(NewMemorySessionStore())
+	conv.now = func() time.Time { return now }
+	conv.SetTimeout(time.Minute)
+	conv.Handle("title", func(context.Context, *Bot, *Session, ConversationInput) (string, error) {
+		return "title", nil
+	})
+
+	key := SessionKey{ChatID: "chat1", UserID: "user1"}
+	ctx := context.Background()
+
+	if _, err := conv.Begin(ctx, key, "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+
+	if s, err := conv.Session(ctx, key); err != nil || s != nil {
+		t.Fatalf("conversation is not expired: %+v, %v", s, err)
+	}
+
+	if _, err := conv.Begin(ctx, key, "unknown"); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConversation_sweep(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemorySessionStore()
+	conv := NewConversation(store)
+	conv.now = func() time.Time { return now }
+	conv.SetTimeout(time.Minute)
+	conv.Handle("title", func(context.Context, *Bot, *Session, ConversationInput) (string, error) {
+		return "title", nil
+	})
+
+	ctx := context.Background()
+	gone := SessionKey{ChatID: "chat1", UserID: "user1"}
+
+	if _, err := conv.Begin(ctx, gone, "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+
+	// the user who never comes back does not keep the session in the store.
+	if _, err := conv.Begin(ctx, SessionKey{ChatID: "chat1", UserID: "user2"}, "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := store.Load(ctx, gone); err != nil || s != nil {
+		t.Fatalf("expired session is not deleted: %+v, %v", s, err)
+	}
+}
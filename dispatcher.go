@@ -0,0 +1,126 @@
+package icqbotapi
+
+import (
+	"context"
+	"hash/fnv"
+
+	"icqbotapi/event"
+)
+
+const (
+	defaultConcurrency = 1
+	defaultQueueSize   = 64
+)
+
+// WithConcurrency sets the number of workers handling events in parallel.
+// Events of the same chat are always handled by the same worker in the order they are received.
+func WithConcurrency(n int) Option {
+	return func(b *Bot) {
+		if n > 0 {
+			b.concurrency = n
+		}
+	}
+}
+
+// WithQueueSize sets the number of events queued for every worker.
+// Polling is paused while the queue of the worker is full.
+func WithQueueSize(n int) Option {
+	return func(b *Bot) {
+		if n >= 0 {
+			b.queueSize = n
+		}
+	}
+}
+
+// startDispatcher dispatches events to the pool of workers until the channel is closed.
+// Events are distributed between workers by the hash of the chat ID, so the events
+// of the same chat are handled strictly in order while different chats are handled in parallel.
+func (b *Bot) startDispatcher(ctx context.Context, run *botRun, events <-chan event.Event, offsets *offsetTracker) {
+	queues := make([]chan event.Event, b.concurrency)
+
+	for i := range queues {
+		queues[i] = make(chan event.Event, b.queueSize)
+
+		run.handlers.Add(1)
+		go func(queue <-chan event.Event) {
+			defer run.handlers.Done()
+
+			for ev := range queue {
+				// events queued after Stop are skipped, since their handlers would get the canceled context.
+				// They are not marked handled, so their IDs are not committed and they are delivered again after restart.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				// the failure is reported to the error handler by safeDispatch.
+				err := b.safeDispatch(ctx, ev)
+				if err != nil && b.deadLetterHandler != nil {
+					b.deadLetterHandler(ctx, ev, err)
+					err = nil
+				}
+
+				offsets.done(ev.EventID, err == nil)
+			}
+		}(queues[i])
+	}
+
+	run.handlers.Add(1)
+	go func() {
+		defer run.handlers.Done()
+
+		for ev := range events {
+			offsets.add(ev.EventID)
+			// the send blocks while the queue is full, which pauses polling.
+			queues[workerIndex(ev.ChatID(), len(queues))] <- ev
+		}
+
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+}
+
+// workerIndex returns the index of the worker handling events of the chat.
+func workerIndex(chatID string, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(chatID))
+
+	return int(h.Sum32() % uint32(workers))
+}
+
+// safeDispatch dispatches the event recovering the panic of the handler.
+// The panic is reported to the error handler as *PanicError, so the bot keeps running.
+// Other errors of the event handling are reported to the error handler too.
+func (b *Bot) safeDispatch(ctx context.Context, ev event.Event) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pe := newPanicError(v, &ev)
+			b.logger.Log(LogLevelError, "event handler panicked",
+				LogField{LogKeyEventID, ev.EventID},
+				LogField{LogKeyEventKind, ev.Type},
+				LogField{LogKeyError, pe},
+				LogField{LogKeyStack, string(pe.Stack)},
+			)
+			b.handleError(pe)
+
+			err = pe
+		}
+	}()
+
+	if err := b.dispatch(ctx, ev); err != nil {
+		b.logger.Log(LogLevelError, "event handling failed",
+			LogField{LogKeyEventID, ev.EventID},
+			LogField{LogKeyEventKind, ev.Type},
+			LogField{LogKeyError, err},
+		)
+		b.handleError(err)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package icqbotapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+)
+
+func TestBot_dispatcherOrdering(t *testing.T) {
+	const workers = 2
+
+	// chats handled by different workers.
+	chat1, chat2 := "chat1", ""
+	for i := 2; chat2 == ""; i++ {
+		if c := fmt.Sprintf("chat%d", i); workerIndex(c, workers) != workerIndex(chat1, workers) {
+			chat2 = c
+		}
+	}
+
+	events := make([]string, 0)
+	for i, chatID := range []string{chat1, chat1, chat2, chat1} {
+		events = append(events, fmt.Sprintf(
+			`{"eventId": %d, "type": "newMessage", "payload": {"msgId": "%d", "chat": {"chatId": "%s"}, "text": "%d"}}`,
+			i+1, i+1, chatID, i+1,
+		))
+	}
+
+	bot, done := newEventsTestBot(strings.Join(events, ","), WithConcurrency(workers))
+	defer done()
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[string][]string)
+	)
+
+	chat2Handled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		if e.Chat.ChatID == chat1 && e.Text == "1" {
+			// the slow handler of chat1 does not stall chat2.
+			select {
+			case <-chat2Handled:
+			case <-time.After(time.Second):
+				t.Error("chat2 is stalled by chat1")
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled[e.Chat.ChatID] = append(handled[e.Chat.ChatID], e.Text)
+
+		switch {
+		case e.Chat.ChatID == chat2:
+			close(chat2Handled)
+		case len(handled[chat1]) == 3:
+			cancel()
+		}
+	})
+
+	if err := bot.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(handled[chat1], ","); got != "1,2,4" {
+		t.Fatalf("unexpected order of chat1 events: %s", got)
+	}
+}
+
+func TestBot_dispatcherPanic(t *testing.T) {
+	bot, done := newEventsTestBot(testNewMessageEvent + "," +
+		`{"eventId": 2, "type": "newMessage", "payload": {"msgId": "2", "chat": {"chatId": "chat1"}, "text": "bye"}}`)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		if e.Text == "hi" {
+			panic("boom")
+		}
+
+		cancel()
+	})
+
+	bot.SetErrorHandler(func(err error) {
+		errs <- err
+	})
+
+	if err := bot.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	default:
+	}
+
+	pe, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("panic is not reported: %v", err)
+	}
+
+	if pe.Value != "boom" || pe.Event == nil || pe.Event.EventID != 1 || len(pe.Stack) == 0 {
+		t.Fatalf("unexpected panic error: %#v", pe)
+	}
+}
@@ -0,0 +1,180 @@
+package icqbotapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"icqbotapi/event"
+)
+
+var (
+	// ErrNotFound is matched by API errors about missing chats, messages or files.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is matched by API errors about insufficient permissions or invalid token.
+	ErrForbidden = errors.New("forbidden")
+	// ErrRateLimited is matched by API errors caused by too many requests.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// APIError represents an error returned by the Bot API server.
+// It is returned when the server responds with non-2xx status code
+// or reports the failure with "ok": false in the response body.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Method is the API method path, e.g. "/messages/sendText".
+	Method string
+	// Description is the error description provided by the server.
+	Description string
+	// Retryable reports whether the request may succeed if repeated later.
+	Retryable bool
+	// RetryAfter is the delay before the next attempt requested by the server, if any.
+	RetryAfter time.Duration
+}
+
+func newAPIError(method string, statusCode int, description string) *APIError {
+	return &APIError{
+		StatusCode:  statusCode,
+		Method:      method,
+		Description: description,
+		Retryable:   statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError,
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("api error: %s: status %d", e.Method, e.StatusCode)
+	}
+
+	return fmt.Sprintf("api error: %s: status %d: %s", e.Method, e.StatusCode, e.Description)
+}
+
+// Is reports whether the error matches one of ErrNotFound, ErrForbidden or ErrRateLimited.
+func (e *APIError) Is(target error) bool {
+	d := strings.ToLower(e.Description)
+
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound ||
+			strings.Contains(d, "not found")
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden ||
+			e.StatusCode == http.StatusUnauthorized ||
+			strings.Contains(d, "permission denied")
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			strings.Contains(d, "too many requests")
+	}
+
+	return false
+}
+
+// IsNotFound reports whether err is an API error about missing entity.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsForbidden reports whether err is an API error about insufficient permissions.
+func IsForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+// IsRateLimited reports whether err is an API error caused by too many requests.
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// IsRetryable reports whether err is an API error which may succeed if repeated later.
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Retryable
+}
+
+// ErrValidation is matched by all request validation errors.
+var ErrValidation = errors.New("validation error")
+
+// FieldViolation describes a validation rule violated by the request field.
+type FieldViolation struct {
+	Field string
+	Rule  string
+}
+
+func (v FieldViolation) String() string {
+	return v.Field + " " + v.Rule
+}
+
+// ValidationError represents a failed request validation.
+// It lists every violated rule of the request.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.String())
+	}
+
+	return ErrValidation.Error() + ": " + strings.Join(rules, "; ")
+}
+
+// Is reports whether target is ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// validator collects violations of request validation rules.
+type validator struct {
+	violations []FieldViolation
+}
+
+// check adds the violation of the rule if the condition is not met.
+func (v *validator) check(cond bool, field, rule string) {
+	if !cond {
+		v.violations = append(v.violations, FieldViolation{Field: field, Rule: rule})
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Violations: v.violations}
+}
+
+// PanicError represents the panic recovered in the event handler or the polling loop.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+	// Event is the event being handled, nil if the panic has occurred while polling.
+	Event *event.Event
+}
+
+func newPanicError(v interface{}, ev *event.Event) *PanicError {
+	return &PanicError{
+		Value: v,
+		Stack: debug.Stack(),
+		Event: ev,
+	}
+}
+
+func (e *PanicError) Error() string {
+	if e.Event == nil {
+		return fmt.Sprintf("panic: %v", e.Value)
+	}
+
+	return fmt.Sprintf("panic while handling event %d of kind %s: %v", e.Event.EventID, e.Event.Type, e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
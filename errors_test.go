@@ -0,0 +1,106 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestBot creates the bot calling the handler. Options override the defaults of tests.
+func newTestBot(h http.HandlerFunc, opts ...Option) (*Bot, func()) {
+	srv := httptest.NewServer(h)
+
+	bot := NewWithOptions("token", append([]Option{
+		WithBaseURL(srv.URL + "/bot/v1"),
+		WithHTTPClient(srv.Client()),
+		WithRetryPolicy(NoRetry),
+		WithLogger(NopLogger),
+	}, opts...)...)
+
+	return bot, srv.Close
+}
+
+func TestBot_APIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		check      func(error) bool
+		retryable  bool
+	}{
+		{
+			name:       "not ok",
+			statusCode: http.StatusOK,
+			body:       `{"ok": false, "description": "Chat not found"}`,
+			check:      IsNotFound,
+		},
+		{
+			name:       "forbidden",
+			statusCode: http.StatusForbidden,
+			body:       `{"ok": false, "description": "Permission denied"}`,
+			check:      IsForbidden,
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			body:       `too many requests`,
+			check:      IsRateLimited,
+			retryable:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			})
+			defer done()
+
+			resp, err := bot.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"})
+			if resp != nil {
+				t.Fatalf("unexpected response: %#v", resp)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("unexpected status code: %d", apiErr.StatusCode)
+			}
+
+			if apiErr.Method != "/messages/sendText" {
+				t.Errorf("unexpected method: %s", apiErr.Method)
+			}
+
+			if apiErr.Retryable != tt.retryable {
+				t.Errorf("unexpected retryable: %v", apiErr.Retryable)
+			}
+
+			if !tt.check(err) {
+				t.Errorf("error is not classified: %v", err)
+			}
+		})
+	}
+}
+
+func TestBot_APIErrorOk(t *testing.T) {
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": true, "msgId": "1"}`))
+	})
+	defer done()
+
+	resp, err := bot.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.MessageID != "1" {
+		t.Fatalf("unexpected message id: %s", resp.MessageID)
+	}
+}
@@ -2,6 +2,8 @@ package event
 
 import (
 	"encoding/json"
+
+	"github.com/mailru/easyjson"
 )
 
 // Kind represents event kind
@@ -15,6 +17,7 @@ const (
 	KindUnpinnedMessage Kind = "unpinnedMessage"
 	KindNewChatMember   Kind = "newChatMembers"
 	KindLeftChatMembers Kind = "leftChatMembers"
+	KindCallbackQuery   Kind = "callbackQuery"
 )
 
 //easyjson:json
@@ -24,6 +27,28 @@ type Event struct {
 	Payload json.RawMessage `json:"payload"`
 }
 
+//easyjson:json
+type chatPayload struct {
+	Chat    Chat `json:"chat"`
+	Message struct {
+		Chat Chat `json:"chat"`
+	} `json:"message"`
+}
+
+// ChatID returns the ID of the chat the event relates to or empty string if the payload has no chat.
+func (e Event) ChatID() string {
+	p := chatPayload{}
+	if err := easyjson.Unmarshal(e.Payload, &p); err != nil {
+		return ""
+	}
+
+	if p.Chat.ChatID == "" {
+		return p.Message.Chat.ChatID
+	}
+
+	return p.Chat.ChatID
+}
+
 type ChatKind string
 
 const (
@@ -102,6 +127,23 @@ type LeftChatMembersPayload struct {
 	RemovedBy   User   `json:"removedBy"`
 }
 
+//easyjson:json
+type CallbackQueryMessage struct {
+	MessageID string `json:"msgId"`
+	Chat      Chat   `json:"chat"`
+	From      User   `json:"from"`
+	Text      string `json:"text"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+//easyjson:json
+type CallbackQueryPayload struct {
+	QueryID      string               `json:"queryId"`
+	From         User                 `json:"from"`
+	Message      CallbackQueryMessage `json:"message"`
+	CallbackData string               `json:"callbackData"`
+}
+
 type Message struct {
 	MessageID string `json:"msgId"`
 	From      User   `json:"from"`
@@ -2,6 +2,9 @@ package event
 
 import (
 	"encoding/json"
+	"errors"
+
+	"github.com/mailru/easyjson"
 )
 
 type MessagePartType string
@@ -66,3 +69,122 @@ type MessagePartForward struct {
 type MessagePartReply struct {
 	Message Message `json:"message"`
 }
+
+// ErrUnknownPartType is returned when decoding the message part of unknown type.
+var ErrUnknownPartType = errors.New("unknown message part type")
+
+// Decode decodes the payload of the message part into the struct of its type:
+// MessagePartSticker, MessagePartMention, MessagePartVoice, MessagePartFile,
+// MessagePartForward or MessagePartReply.
+// It returns ErrUnknownPartType if the type is unknown.
+func (p MessagePart) Decode() (interface{}, error) {
+	switch p.Type {
+	case PartTypeSticker:
+		v := MessagePartSticker{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	case PartTypeMention:
+		v := MessagePartMention{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	case PartTypeVoice:
+		v := MessagePartVoice{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	case PartTypeFile:
+		v := MessagePartFile{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	case PartTypeForward:
+		v := MessagePartForward{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	case PartTypeReply:
+		v := MessagePartReply{}
+		err := easyjson.Unmarshal(p.Payload, &v)
+		return v, err
+	}
+
+	return nil, ErrUnknownPartType
+}
+
+// eachPart decodes the message parts of the type and passes them to fn.
+func (p NewMessagePayload) eachPart(t MessagePartType, fn func(v interface{})) error {
+	for _, part := range p.Parts {
+		if part.Type != t {
+			continue
+		}
+
+		v, err := part.Decode()
+		if err != nil {
+			return err
+		}
+
+		fn(v)
+	}
+
+	return nil
+}
+
+// Stickers returns the stickers of the message.
+func (p NewMessagePayload) Stickers() ([]MessagePartSticker, error) {
+	var res []MessagePartSticker
+	err := p.eachPart(PartTypeSticker, func(v interface{}) {
+		res = append(res, v.(MessagePartSticker))
+	})
+
+	return res, err
+}
+
+// Mentions returns the users mentioned in the message.
+func (p NewMessagePayload) Mentions() ([]MessagePartMention, error) {
+	var res []MessagePartMention
+	err := p.eachPart(PartTypeMention, func(v interface{}) {
+		res = append(res, v.(MessagePartMention))
+	})
+
+	return res, err
+}
+
+// Voices returns the voice messages attached to the message.
+func (p NewMessagePayload) Voices() ([]MessagePartVoice, error) {
+	var res []MessagePartVoice
+	err := p.eachPart(PartTypeVoice, func(v interface{}) {
+		res = append(res, v.(MessagePartVoice))
+	})
+
+	return res, err
+}
+
+// Files returns the files attached to the message.
+func (p NewMessagePayload) Files() ([]MessagePartFile, error) {
+	var res []MessagePartFile
+	err := p.eachPart(PartTypeFile, func(v interface{}) {
+		res = append(res, v.(MessagePartFile))
+	})
+
+	return res, err
+}
+
+// Forwards returns the messages forwarded with the message.
+func (p NewMessagePayload) Forwards() ([]MessagePartForward, error) {
+	var res []MessagePartForward
+	err := p.eachPart(PartTypeForward, func(v interface{}) {
+		res = append(res, v.(MessagePartForward))
+	})
+
+	return res, err
+}
+
+// Reply returns the message replied to or nil if the message is not a reply.
+func (p NewMessagePayload) Reply() (*MessagePartReply, error) {
+	var res *MessagePartReply
+	err := p.eachPart(PartTypeReply, func(v interface{}) {
+		if res == nil {
+			r := v.(MessagePartReply)
+			res = &r
+		}
+	})
+
+	return res, err
+}
@@ -0,0 +1,63 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewMessagePayload_Parts(t *testing.T) {
+	p := NewMessagePayload{
+		Parts: []MessagePart{
+			{Type: PartTypeMention, Payload: json.RawMessage(`{"userId": "user1", "firstName": "Ann"}`)},
+			{Type: PartTypeFile, Payload: json.RawMessage(`{"fileId": "file1", "type": "image", "caption": "pic"}`)},
+			{Type: PartTypeReply, Payload: json.RawMessage(`{"message": {"msgId": "1", "text": "hi"}}`)},
+			{Type: PartTypeMention, Payload: json.RawMessage(`{"userId": "user2"}`)},
+		},
+	}
+
+	mentions, err := p.Mentions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mentions) != 2 || mentions[0].UserID != "user1" || mentions[1].UserID != "user2" {
+		t.Fatalf("unexpected mentions: %#v", mentions)
+	}
+
+	files, err := p.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].FileID != "file1" || files[0].Type != FileTypeImage {
+		t.Fatalf("unexpected files: %#v", files)
+	}
+
+	reply, err := p.Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply == nil || reply.Message.Text != "hi" {
+		t.Fatalf("unexpected reply: %#v", reply)
+	}
+
+	if stickers, err := p.Stickers(); err != nil || len(stickers) != 0 {
+		t.Fatalf("unexpected stickers: %#v, %v", stickers, err)
+	}
+}
+
+func TestMessagePart_Decode(t *testing.T) {
+	v, err := MessagePart{Type: PartTypeSticker, Payload: json.RawMessage(`{"fileId": "sticker1"}`)}.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, ok := v.(MessagePartSticker); !ok || s.FileID != "sticker1" {
+		t.Fatalf("unexpected part: %#v", v)
+	}
+
+	if _, err := (MessagePart{Type: "poll"}).Decode(); err != ErrUnknownPartType {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/mailru/easyjson"
+)
+
+// ErrUnknownKind is returned when decoding the event of kind without registered decoder.
+var ErrUnknownKind = errors.New("unknown event kind")
+
+// Decoder decodes the payload of the event.
+type Decoder func(payload json.RawMessage) (interface{}, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[Kind]Decoder{
+		KindNewMessage: func(p json.RawMessage) (interface{}, error) {
+			v := NewMessagePayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindEditedMessage: func(p json.RawMessage) (interface{}, error) {
+			v := MessageEditPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindDeletedMessage: func(p json.RawMessage) (interface{}, error) {
+			v := MessageDeletePayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindPinnedMessage: func(p json.RawMessage) (interface{}, error) {
+			v := MessagePinPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindUnpinnedMessage: func(p json.RawMessage) (interface{}, error) {
+			v := MessageUnpinPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindNewChatMember: func(p json.RawMessage) (interface{}, error) {
+			v := NewChatMembersPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindLeftChatMembers: func(p json.RawMessage) (interface{}, error) {
+			v := LeftChatMembersPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+		KindCallbackQuery: func(p json.RawMessage) (interface{}, error) {
+			v := CallbackQueryPayload{}
+			err := easyjson.Unmarshal(p, &v)
+			return v, err
+		},
+	}
+)
+
+// RegisterDecoder registers the payload decoder of the event kind.
+// It allows to decode custom or future event kinds not known to the library.
+// It panics if the kind is built-in, as the bot relies on the types of their payloads.
+func RegisterDecoder(k Kind, d Decoder) {
+	if isBuiltin(k) {
+		panic("event: decoder of the built-in kind " + string(k) + " can not be replaced")
+	}
+
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[k] = d
+}
+
+// unregisterDecoder removes the decoder of the custom kind.
+func unregisterDecoder(k Kind) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	delete(decoders, k)
+}
+
+func isBuiltin(k Kind) bool {
+	switch k {
+	case KindNewMessage, KindEditedMessage, KindDeletedMessage, KindPinnedMessage,
+		KindUnpinnedMessage, KindNewChatMember, KindLeftChatMembers, KindCallbackQuery:
+		return true
+	}
+
+	return false
+}
+
+// IsKnown reports whether the event kind has the registered decoder.
+func IsKnown(k Kind) bool {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	_, ok := decoders[k]
+
+	return ok
+}
+
+// Decode decodes the payload of the event with the decoder registered for its kind.
+// It returns ErrUnknownKind if there is no decoder.
+func (e Event) Decode() (interface{}, error) {
+	decodersMu.RLock()
+	d, ok := decoders[e.Type]
+	decodersMu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+
+	return d(e.Payload)
+}
@@ -0,0 +1,60 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEvent_Decode(t *testing.T) {
+	e := Event{
+		EventID: 1,
+		Type:    KindNewMessage,
+		Payload: json.RawMessage(`{"msgId": "1", "chat": {"chatId": "chat1"}, "text": "hi"}`),
+	}
+
+	p, err := e.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m, ok := p.(NewMessagePayload); !ok || m.Text != "hi" || m.Chat.ChatID != "chat1" {
+		t.Fatalf("unexpected payload: %#v", p)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	const kind Kind = "customKind"
+
+	e := Event{Type: kind, Payload: json.RawMessage(`"payload"`)}
+
+	if _, err := e.Decode(); err != ErrUnknownKind {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	RegisterDecoder(kind, func(p json.RawMessage) (interface{}, error) {
+		var s string
+		err := json.Unmarshal(p, &s)
+		return s, err
+	})
+	defer unregisterDecoder(kind)
+
+	if !IsKnown(kind) {
+		t.Fatal("kind is not registered")
+	}
+
+	if p, err := e.Decode(); err != nil || p != "payload" {
+		t.Fatalf("unexpected payload: %v, %v", p, err)
+	}
+}
+
+func TestRegisterDecoder_builtinKind(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("decoder of the built-in kind is replaced")
+		}
+	}()
+
+	RegisterDecoder(KindNewMessage, func(p json.RawMessage) (interface{}, error) {
+		return nil, nil
+	})
+}
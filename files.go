@@ -2,21 +2,24 @@ package icqbotapi
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
-
-	"github.com/mailru/easyjson"
+	"strconv"
+	"strings"
 )
 
 // FileID represents file identifier.
 type FileID string
 
 func (r FileID) validate() error {
-	if r == "" {
-		return errValidation
-	}
+	v := &validator{}
+	v.check(r != "", "FileID", "is required")
 
-	return nil
+	return v.err()
 }
 
 func (r FileID) contributeToQuery(q url.Values) {
@@ -57,10 +60,201 @@ func (b *Bot) GetFileInfo(ctx context.Context, r FileID) (*FileInfoResponse, err
 	defer httpResp.Body.Close()
 
 	resp := &FileInfoResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
 
 	return resp, nil
 }
+
+const (
+	// downloadMethod is the pseudo API method of downloading the file content used in logs and retry policies.
+	downloadMethod = "/files/download"
+	// maxDownloadResumes is the number of consecutive attempts to resume the download without progress.
+	maxDownloadResumes = 3
+)
+
+// ErrSizeMismatch is returned when the size of the downloaded file differs from the size reported by GetFileInfo.
+var ErrSizeMismatch = errors.New("downloaded file size mismatch")
+
+// WithMaxDownloadSize sets the maximum size of the file downloaded with DownloadFile or OpenFile.
+// Zero size means no limit.
+func WithMaxDownloadSize(n int64) Option {
+	return func(b *Bot) {
+		if n >= 0 {
+			b.maxDownloadSize = n
+		}
+	}
+}
+
+// OpenFile opens the content of the file for reading. The reader must be closed.
+// The interrupted download is resumed from the last read byte with HTTP Range requests.
+// The reader returns ErrSizeMismatch if the content size differs from the size in the file info.
+// It returns ErrFileTooLarge if the file exceeds the size set WithMaxDownloadSize.
+func (b *Bot) OpenFile(ctx context.Context, id FileID) (io.ReadCloser, *FileInfoResponse, error) {
+	info, err := b.GetFileInfo(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b.maxDownloadSize > 0 && int64(info.Size) > b.maxDownloadSize {
+		return nil, nil, ErrFileTooLarge
+	}
+
+	r := &fileReader{
+		bot:  b,
+		ctx:  ctx,
+		url:  info.URL,
+		size: int64(info.Size),
+	}
+
+	if err := r.open(); err != nil {
+		return nil, nil, err
+	}
+
+	return r, info, nil
+}
+
+// DownloadFile writes the content of the file to the writer like OpenFile.
+func (b *Bot) DownloadFile(ctx context.Context, id FileID, w io.Writer) (*FileInfoResponse, error) {
+	r, info, err := b.OpenFile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// fileReader reads the file content resuming the interrupted download.
+type fileReader struct {
+	bot     *Bot
+	ctx     context.Context
+	url     string
+	size    int64
+	offset  int64
+	resumes int
+	body    io.ReadCloser
+}
+
+// open requests the content starting from the offset.
+func (r *fileReader) open() error {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(r.ctx)
+
+	if r.offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+	}
+
+	if r.bot.userAgent != "" {
+		req.Header.Set("User-Agent", r.bot.userAgent)
+	}
+
+	// the token is not added, since the file URL is already authorized and may point to other host.
+	resp, err := r.bot.doMethodRequestWithRetry(r.ctx, downloadMethod, req)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && r.offset > 0:
+		// the content must be resumed exactly from the offset.
+		if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, "bytes "+strconv.FormatInt(r.offset, 10)+"-") {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected content range %q of the resumed download", cr)
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the server ignoring the range sends the content from the start.
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && r.offset > 0:
+		// the content ended before the size in the file info.
+		resp.Body.Close()
+		return ErrSizeMismatch
+	default:
+		resp.Body.Close()
+		return newAPIError(downloadMethod, resp.StatusCode, "")
+	}
+
+	r.body = resp.Body
+
+	return nil
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+
+		if r.offset > r.size {
+			return n, ErrSizeMismatch
+		}
+
+		if n > 0 {
+			r.resumes = 0
+		}
+
+		// the complete content is not resumed, even if the connection failed right after it.
+		if err != nil && r.offset == r.size {
+			return n, io.EOF
+		}
+
+		if err == nil {
+			return n, nil
+		}
+
+		if r.ctx.Err() != nil {
+			return n, r.ctx.Err()
+		}
+
+		// the download is interrupted, including the premature end of the content.
+		r.resumes++
+		if r.resumes > maxDownloadResumes {
+			if err == io.EOF {
+				err = ErrSizeMismatch
+			}
+
+			return n, err
+		}
+
+		r.body.Close()
+
+		if openErr := r.open(); openErr != nil {
+			r.body = errReader{openErr}
+			return n, openErr
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *fileReader) Close() error {
+	return r.body.Close()
+}
+
+// errReader is the closed body which returns the error.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func (r errReader) Close() error {
+	return nil
+}
@@ -1,9 +1,20 @@
 package icqbotapi
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"icqbotapi/icqtest"
 )
 
 func ExampleBot_GetFileInfo() {
@@ -14,3 +25,176 @@ func ExampleBot_GetFileInfo() {
 
 	log.Printf("%#v", data)
 }
+
+func TestBot_DownloadFile(t *testing.T) {
+	bot, srv := newUploadTestBot()
+	defer srv.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	id := srv.AddFile(icqtest.File{Filename: "a.bin", Content: content})
+
+	buf := &bytes.Buffer{}
+
+	info, err := bot.DownloadFile(context.Background(), FileID(id), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Filename != "a.bin" || !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("unexpected file: %+v", info)
+	}
+
+	bot = newServerTestBot(srv, WithMaxDownloadSize(int64(len(content)-1)))
+
+	if _, _, err := bot.OpenFile(context.Background(), FileID(id)); err != ErrFileTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := len(srv.RequestsTo(downloadMethod)); n != 1 {
+		t.Fatalf("too large file is downloaded: %d requests", n)
+	}
+}
+
+func TestBot_DownloadFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	tests := []struct {
+		name     string
+		infoSize int
+		wantErr  error
+	}{
+		{name: "resumed", infoSize: len(content)},
+		{name: "shorter content", infoSize: len(content) + 1, wantErr: ErrSizeMismatch},
+		{name: "longer content", infoSize: len(content) - 1, wantErr: ErrSizeMismatch},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				ranges []string
+			)
+
+			var fileURL string
+
+			bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/files/getInfo") {
+					_, _ = fmt.Fprintf(w, `{"ok": true, "size": %d, "url": "%s"}`, tt.infoSize, fileURL)
+					return
+				}
+
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				first := len(ranges) == 1
+				mu.Unlock()
+
+				if first {
+					// the connection is broken in the middle of the content.
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					_, _ = w.Write(content[:len(content)/2])
+
+					return
+				}
+
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			})
+			defer done()
+
+			fileURL = strings.TrimSuffix(bot.apiBaseURL, "/bot/v1") + "/download"
+
+			buf := &bytes.Buffer{}
+			_, err := bot.DownloadFile(context.Background(), "file1", buf)
+
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), content) {
+				t.Fatalf("unexpected content of %d bytes", buf.Len())
+			}
+
+			if want := []string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"}; !reflect.DeepEqual(ranges, want) {
+				t.Fatalf("unexpected ranges: %q", ranges)
+			}
+		})
+	}
+}
+
+func TestBot_DownloadFileFailureAfterContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var (
+		fileURL   string
+		downloads int32
+	)
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/files/getInfo") {
+			_, _ = fmt.Fprintf(w, `{"ok": true, "size": %d, "url": "%s"}`, len(content), fileURL)
+			return
+		}
+
+		atomic.AddInt32(&downloads, 1)
+
+		// the connection is broken right after the complete content.
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)+10))
+		_, _ = w.Write(content)
+	})
+	defer done()
+
+	fileURL = strings.TrimSuffix(bot.apiBaseURL, "/bot/v1") + "/download"
+
+	buf := &bytes.Buffer{}
+	if _, err := bot.DownloadFile(context.Background(), "file1", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), content) || downloads != 1 {
+		t.Fatalf("unexpected download of %d bytes in %d requests", buf.Len(), downloads)
+	}
+}
+
+func TestBot_DownloadFileUnexpectedRange(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var (
+		fileURL   string
+		downloads int32
+	)
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/files/getInfo") {
+			_, _ = fmt.Fprintf(w, `{"ok": true, "size": %d, "url": "%s"}`, len(content), fileURL)
+			return
+		}
+
+		if atomic.AddInt32(&downloads, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+
+			return
+		}
+
+		// the server resumes from the wrong offset.
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content)
+	})
+	defer done()
+
+	fileURL = strings.TrimSuffix(bot.apiBaseURL, "/bot/v1") + "/download"
+
+	buf := &bytes.Buffer{}
+	if _, err := bot.DownloadFile(context.Background(), "file1", buf); err == nil || !strings.Contains(err.Error(), "content range") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
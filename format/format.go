@@ -0,0 +1,158 @@
+// Package format builds formatted message text with correctly escaped markup.
+package format
+
+import (
+	"html"
+	"strings"
+)
+
+// Mode represents the text formatting mode supported by the server.
+type Mode string
+
+const (
+	ModeMarkdownV2 Mode = "MarkdownV2"
+	ModeHTML       Mode = "HTML"
+)
+
+// markdownV2Special lists characters which must be escaped in MarkdownV2 text.
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// Escape escapes the plain text, so that it is displayed as is in the mode.
+func Escape(mode Mode, s string) string {
+	if mode == ModeHTML {
+		return html.EscapeString(s)
+	}
+
+	return escapeMarkdownV2(s, markdownV2Special)
+}
+
+func escapeMarkdownV2(s, special string) string {
+	sb := strings.Builder{}
+	sb.Grow(len(s))
+
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// Builder builds the formatted text. Every piece of text is escaped according to the mode.
+type Builder struct {
+	mode Mode
+	sb   strings.Builder
+}
+
+// NewBuilder creates the builder of the text formatted in the mode.
+func NewBuilder(mode Mode) *Builder {
+	return &Builder{
+		mode: mode,
+	}
+}
+
+// Mode returns the formatting mode of the builder.
+func (b *Builder) Mode() Mode {
+	return b.mode
+}
+
+// Text appends the plain text.
+func (b *Builder) Text(s string) *Builder {
+	b.sb.WriteString(Escape(b.mode, s))
+	return b
+}
+
+// Bold appends the bold text.
+func (b *Builder) Bold(s string) *Builder {
+	return b.wrap("*", "b", s)
+}
+
+// Italic appends the italic text.
+func (b *Builder) Italic(s string) *Builder {
+	return b.wrap("_", "i", s)
+}
+
+// Code appends the inline code.
+func (b *Builder) Code(s string) *Builder {
+	if b.mode == ModeHTML {
+		b.sb.WriteString("<code>" + html.EscapeString(s) + "</code>")
+		return b
+	}
+
+	b.sb.WriteString("`" + escapeMarkdownV2(s, "`\\") + "`")
+
+	return b
+}
+
+// Pre appends the preformatted block of code in the language, which can be empty.
+func (b *Builder) Pre(s, language string) *Builder {
+	if b.mode == ModeHTML {
+		if language == "" {
+			b.sb.WriteString("<pre>" + html.EscapeString(s) + "</pre>")
+			return b
+		}
+
+		b.sb.WriteString(`<pre><code class="language-` + html.EscapeString(language) + `">` +
+			html.EscapeString(s) + "</code></pre>")
+
+		return b
+	}
+
+	b.sb.WriteString("```" + escapeMarkdownV2(language, "`\\") + "\n" + escapeMarkdownV2(s, "`\\") + "\n```")
+
+	return b
+}
+
+// Link appends the text linked to the URL.
+func (b *Builder) Link(text, u string) *Builder {
+	if b.mode == ModeHTML {
+		b.sb.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(text) + "</a>")
+		return b
+	}
+
+	b.sb.WriteString("[" + Escape(b.mode, text) + "](" + escapeMarkdownV2(u, ")\\") + ")")
+
+	return b
+}
+
+// Mention appends the mention of the user written as @[userId].
+func (b *Builder) Mention(userID string) *Builder {
+	b.sb.WriteString(Escape(b.mode, "@["+userID+"]"))
+	return b
+}
+
+// Quote appends the quoted text.
+func (b *Builder) Quote(s string) *Builder {
+	if b.mode == ModeHTML {
+		b.sb.WriteString("<blockquote>" + html.EscapeString(s) + "</blockquote>")
+		return b
+	}
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = ">" + Escape(b.mode, line)
+	}
+
+	b.sb.WriteString(strings.Join(lines, "\n"))
+
+	return b
+}
+
+// String returns the formatted text.
+func (b *Builder) String() string {
+	return b.sb.String()
+}
+
+func (b *Builder) wrap(markdownDelim, htmlTag, s string) *Builder {
+	if b.mode == ModeHTML {
+		b.sb.WriteString("<" + htmlTag + ">" + html.EscapeString(s) + "</" + htmlTag + ">")
+		return b
+	}
+
+	b.sb.WriteString(markdownDelim + Escape(b.mode, s) + markdownDelim)
+
+	return b
+}
@@ -0,0 +1,122 @@
+package format
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  Mode
+		build func(b *Builder)
+		want  string
+	}{
+		{
+			name: "markdown",
+			mode: ModeMarkdownV2,
+			build: func(b *Builder) {
+				b.Text("1+1=2. ").Bold("a*b").Text(" ").Italic("x_y").Text(" ").Code("`c`")
+			},
+			want: "1\\+1\\=2\\. *a\\*b* _x\\_y_ `\\`c\\``",
+		},
+		{
+			name: "markdown link",
+			mode: ModeMarkdownV2,
+			build: func(b *Builder) {
+				b.Link("site [1]", "https://example.com/(a)")
+			},
+			want: "[site \\[1\\]](https://example.com/(a\\))",
+		},
+		{
+			name: "markdown quote",
+			mode: ModeMarkdownV2,
+			build: func(b *Builder) {
+				b.Quote("a.\nb")
+			},
+			want: ">a\\.\n>b",
+		},
+		{
+			name: "html",
+			mode: ModeHTML,
+			build: func(b *Builder) {
+				b.Text("a<b ").Bold("&").Text(" ").Link("x", `https://example.com/?a="1"`)
+			},
+			want: `a&lt;b <b>&amp;</b> <a href="https://example.com/?a=&#34;1&#34;">x</a>`,
+		},
+		{
+			name: "html pre",
+			mode: ModeHTML,
+			build: func(b *Builder) {
+				b.Pre("if a < b {}", "go")
+			},
+			want: `<pre><code class="language-go">if a &lt; b {}</code></pre>`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder(tt.mode)
+			tt.build(b)
+
+			if got := b.String(); got != tt.want {
+				t.Fatalf("unexpected text: %q", got)
+			}
+
+			if err := Validate(tt.mode, b.String()); err != nil {
+				t.Fatalf("built text is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       Mode
+		text       string
+		wantOffset int
+	}{
+		{name: "markdown plain", mode: ModeMarkdownV2, text: "plain \\. text", wantOffset: -1},
+		{name: "markdown nested", mode: ModeMarkdownV2, text: "*bold _italic_* __u__ ||s||", wantOffset: -1},
+		{name: "markdown code", mode: ModeMarkdownV2, text: "`*` ```go\n_\n```", wantOffset: -1},
+		{name: "markdown link", mode: ModeMarkdownV2, text: "[*a*](http://x.y/\\))", wantOffset: -1},
+		{name: "markdown unclosed", mode: ModeMarkdownV2, text: "a *b", wantOffset: 2},
+		{name: "markdown crossed", mode: ModeMarkdownV2, text: "*a _b* c_", wantOffset: 8},
+		{name: "markdown unclosed code", mode: ModeMarkdownV2, text: "a `b", wantOffset: 2},
+		{name: "markdown link without url", mode: ModeMarkdownV2, text: "[a] b", wantOffset: 2},
+		{name: "markdown trailing backslash", mode: ModeMarkdownV2, text: "a\\", wantOffset: 1},
+		{name: "html nested", mode: ModeHTML, text: `<b>a <i>b</i></b> <a href="x">c</a> &lt;`, wantOffset: -1},
+		{name: "html unclosed", mode: ModeHTML, text: "<b>a", wantOffset: 0},
+		{name: "html mismatched", mode: ModeHTML, text: "<b><i>a</b></i>", wantOffset: 7},
+		{name: "html unknown tag", mode: ModeHTML, text: "<script>", wantOffset: 0},
+		{name: "html stray", mode: ModeHTML, text: "a < b", wantOffset: 2},
+		{name: "html empty tag", mode: ModeHTML, text: "a <> b", wantOffset: 2},
+		{name: "html empty closing tag", mode: ModeHTML, text: "</>", wantOffset: 0},
+		{name: "html blank tag", mode: ModeHTML, text: "< >", wantOffset: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.mode, tt.text)
+			if tt.wantOffset < 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			var sErr *SyntaxError
+			if !errors.As(err, &sErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if sErr.Offset != tt.wantOffset {
+				t.Fatalf("unexpected offset: %v", sErr)
+			}
+		})
+	}
+}
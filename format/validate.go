@@ -0,0 +1,193 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError represents the malformed markup of the formatted text.
+type SyntaxError struct {
+	Mode Mode
+	// Offset is the byte offset of the malformed markup in the text.
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid %s markup at offset %d: %s", e.Mode, e.Offset, e.Msg)
+}
+
+// htmlTags lists the tags supported in HTML mode.
+var htmlTags = map[string]bool{
+	"b": true, "strong": true,
+	"i": true, "em": true,
+	"u": true, "ins": true,
+	"s": true, "strike": true, "del": true,
+	"a":          true,
+	"code":       true,
+	"pre":        true,
+	"blockquote": true,
+}
+
+// Validate checks that the markup of the text is balanced in the mode.
+// It returns *SyntaxError describing the first problem found.
+func Validate(mode Mode, text string) error {
+	switch mode {
+	case ModeMarkdownV2:
+		return validateMarkdownV2(text)
+	case ModeHTML:
+		return validateHTML(text)
+	}
+
+	return fmt.Errorf("unknown format mode: %q", mode)
+}
+
+type openEntity struct {
+	delim  string
+	offset int
+}
+
+func validateMarkdownV2(text string) error {
+	syntaxErr := func(offset int, msg string) error {
+		return &SyntaxError{Mode: ModeMarkdownV2, Offset: offset, Msg: msg}
+	}
+
+	var stack []openEntity
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch {
+		case c == '\\':
+			if i+1 >= len(text) {
+				return syntaxErr(i, "trailing backslash")
+			}
+
+			i++
+		case strings.HasPrefix(text[i:], "```"), c == '`':
+			delim := text[i : i+1]
+			if strings.HasPrefix(text[i:], "```") {
+				delim = "```"
+			}
+
+			end := indexUnescaped(text, i+len(delim), delim)
+			if end < 0 {
+				return syntaxErr(i, "unclosed "+delim)
+			}
+
+			i = end + len(delim) - 1
+		case c == '*' || c == '_' || c == '~' || c == '|' || c == '[':
+			delim := text[i : i+1]
+			if (c == '_' || c == '|') && i+1 < len(text) && text[i+1] == c {
+				delim = text[i : i+2]
+			} else if c == '|' {
+				return syntaxErr(i, "unescaped |")
+			}
+
+			if c == '[' {
+				stack = append(stack, openEntity{delim: "[", offset: i})
+				continue
+			}
+
+			if n := len(stack); n > 0 && stack[n-1].delim == delim {
+				stack = stack[:n-1]
+			} else {
+				stack = append(stack, openEntity{delim: delim, offset: i})
+			}
+
+			i += len(delim) - 1
+		case c == ']':
+			n := len(stack)
+			if n == 0 || stack[n-1].delim != "[" {
+				return syntaxErr(i, "unexpected ]")
+			}
+
+			stack = stack[:n-1]
+
+			if i+1 >= len(text) || text[i+1] != '(' {
+				return syntaxErr(i, "link text is not followed by URL")
+			}
+
+			end := indexUnescaped(text, i+2, ")")
+			if end < 0 {
+				return syntaxErr(i+1, "unclosed (")
+			}
+
+			i = end
+		}
+	}
+
+	if n := len(stack); n > 0 {
+		return syntaxErr(stack[n-1].offset, "unclosed "+stack[n-1].delim)
+	}
+
+	return nil
+}
+
+// indexUnescaped returns the index of the first unescaped delim in the text starting from the offset or -1.
+func indexUnescaped(text string, offset int, delim string) int {
+	for i := offset; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(text[i:], delim) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func validateHTML(text string) error {
+	syntaxErr := func(offset int, msg string) error {
+		return &SyntaxError{Mode: ModeHTML, Offset: offset, Msg: msg}
+	}
+
+	var stack []openEntity
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '>':
+			return syntaxErr(i, "unescaped >")
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				return syntaxErr(i, "unescaped <")
+			}
+
+			tag := text[i+1 : i+end]
+			closing := strings.HasPrefix(tag, "/")
+			fields := strings.Fields(strings.TrimPrefix(tag, "/"))
+			if len(fields) == 0 {
+				return syntaxErr(i, "empty tag <"+tag+">")
+			}
+
+			name := strings.ToLower(fields[0])
+
+			if !htmlTags[name] {
+				return syntaxErr(i, "unsupported tag <"+tag+">")
+			}
+
+			if closing {
+				n := len(stack)
+				if n == 0 || stack[n-1].delim != name {
+					return syntaxErr(i, "unexpected </"+name+">")
+				}
+
+				stack = stack[:n-1]
+			} else {
+				stack = append(stack, openEntity{delim: name, offset: i})
+			}
+
+			i += end
+		}
+	}
+
+	if n := len(stack); n > 0 {
+		return syntaxErr(stack[n-1].offset, "unclosed <"+stack[n-1].delim+">")
+	}
+
+	return nil
+}
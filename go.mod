@@ -1,6 +1,6 @@
 module icqbotapi
 
-go 1.12
+go 1.13
 
 require (
 	github.com/davecgh/go-spew v1.1.1
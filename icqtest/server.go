@@ -0,0 +1,639 @@
+// Package icqtest provides the in-process fake of the Bot API server for tests.
+//
+// The server keeps chats, messages, files and events in memory, lets tests inject
+// events and failures and records all requests for assertions:
+//
+//	srv := icqtest.NewServer()
+//	defer srv.Close()
+//
+//	bot := icqbotapi.NewWithOptions(srv.Token, icqbotapi.WithBaseURL(srv.URL()))
+package icqtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"icqbotapi/event"
+)
+
+const (
+	// DefaultToken is the token accepted by the server created with NewServer.
+	DefaultToken = "001.0000000000.0000000000:000000000"
+
+	basePath = "/bot/v1"
+	// maxPollTime caps the time the events request waits for new events, so tests do not hang.
+	maxPollTime = time.Second
+)
+
+// Self represents the bot returned by /self/get.
+type Self struct {
+	UserID    string
+	Nick      string
+	FirstName string
+	About     string
+}
+
+// Chat represents the chat returned by /chats/getInfo and /chats/getAdmins.
+type Chat struct {
+	ChatID     string
+	Title      string
+	Group      string
+	Public     bool
+	InviteLink string
+	Admins     []Admin
+}
+
+// Admin represents the administrator of the chat.
+type Admin struct {
+	UserID    string
+	IsCreator bool
+}
+
+// File represents the file returned by /files/getInfo and served for download.
+type File struct {
+	FileID   string
+	Type     string
+	Filename string
+	Content  []byte
+}
+
+// Message represents the message sent by the bot.
+type Message struct {
+	MessageID string
+	ChatID    string
+	Text      string
+	FileID    string
+	Caption   string
+	// Query is the query of the request which sent or edited the message.
+	Query url.Values
+}
+
+// Request represents the request received by the server.
+type Request struct {
+	// Method is the API method path, e.g. "/messages/sendText".
+	Method string
+	// HTTPMethod is the HTTP method of the request.
+	HTTPMethod string
+	Query      url.Values
+	Header     http.Header
+	Body       []byte
+}
+
+// Failure represents the failure injected to the response of the API method.
+type Failure struct {
+	// StatusCode is the HTTP status code of the response. The server responds
+	// with 200 status code and "ok": false in the body if it is zero.
+	StatusCode  int
+	Description string
+	// RetryAfter is set to the Retry-After header if not zero.
+	RetryAfter time.Duration
+}
+
+// Server is the fake Bot API server. Its methods are safe for concurrent use.
+type Server struct {
+	// Token is the token required in requests. Any token is accepted if it is empty.
+	Token string
+
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	self        Self
+	chats       map[string]*Chat
+	files       map[string]*File
+	messages    map[string]*Message
+	order       []string
+	events      []event.Event
+	lastEventID int
+	newEvents   chan struct{}
+	failures    map[string][]Failure
+	requests    []Request
+	lastID      int
+}
+
+// NewServer starts the server accepting DefaultToken. The server must be closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		Token: DefaultToken,
+		self: Self{
+			UserID:    "100000000",
+			Nick:      "testbot",
+			FirstName: "Test Bot",
+		},
+		chats:     make(map[string]*Chat),
+		files:     make(map[string]*File),
+		messages:  make(map[string]*Message),
+		newEvents: make(chan struct{}),
+		failures:  make(map[string][]Failure),
+	}
+
+	s.srv = httptest.NewServer(s)
+
+	return s
+}
+
+// URL returns the base URL of the API to be passed to icqbotapi.WithBaseURL.
+func (s *Server) URL() string {
+	return s.srv.URL + basePath
+}
+
+// Client returns the HTTP client configured for the server.
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+// Close shuts down the server blocking until all requests finish.
+func (s *Server) Close() {
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// SetSelf sets the bot returned by /self/get.
+func (s *Server) SetSelf(self Self) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.self = self
+}
+
+// AddChat adds or replaces the chat.
+func (s *Server) AddChat(c Chat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chats[c.ChatID] = &c
+}
+
+// AddFile adds or replaces the file. The file ID is generated if it is empty.
+// It returns the ID of the file.
+func (s *Server) AddFile(f File) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.FileID == "" {
+		f.FileID = s.nextID("file")
+	}
+
+	s.files[f.FileID] = &f
+
+	return f.FileID
+}
+
+// File returns the file uploaded to the server or added with AddFile.
+func (s *Server) File(fileID string) (File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[fileID]
+	if !ok {
+		return File{}, false
+	}
+
+	return *f, true
+}
+
+// PushEvent adds the event of the kind with the payload marshaled to JSON.
+// It returns the ID of the event.
+func (s *Server) PushEvent(kind event.Kind, payload interface{}) int {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		panic("icqtest: marshaling event payload: " + err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastEventID++
+	s.events = append(s.events, event.Event{EventID: s.lastEventID, Type: kind, Payload: p})
+
+	// wake up the pending events requests.
+	close(s.newEvents)
+	s.newEvents = make(chan struct{})
+
+	return s.lastEventID
+}
+
+// PushNewMessage adds the event about the new message of the user in the chat.
+// It returns the ID of the event.
+func (s *Server) PushNewMessage(chatID, userID, text string) int {
+	s.mu.Lock()
+	msgID := s.nextID("msg")
+	s.mu.Unlock()
+
+	return s.PushEvent(event.KindNewMessage, event.NewMessagePayload{
+		MessageID: msgID,
+		Chat:      event.Chat{ChatID: chatID},
+		From:      event.User{UserID: userID},
+		Timestamp: uint64(time.Now().Unix()),
+		Text:      text,
+	})
+}
+
+// Fail makes the next request to the API method, e.g. "/messages/sendText", fail.
+// Failures of the same method are used in the order they are added.
+func (s *Server) Fail(method string, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], f)
+}
+
+// Requests returns all received requests in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the received requests to the API method in order.
+func (s *Server) RequestsTo(method string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []Request
+
+	for _, r := range s.requests {
+		if r.Method == method {
+			reqs = append(reqs, r)
+		}
+	}
+
+	return reqs
+}
+
+// Messages returns messages of the chat which have not been deleted in the order they are sent.
+func (s *Server) Messages(chatID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msgs []Message
+
+	for _, id := range s.order {
+		if m, ok := s.messages[id]; ok && m.ChatID == chatID {
+			msgs = append(msgs, *m)
+		}
+	}
+
+	return msgs
+}
+
+// nextID generates the unique ID with the prefix. It must be called under the lock.
+func (s *Server) nextID(prefix string) string {
+	s.lastID++
+	return prefix + strconv.Itoa(s.lastID)
+}
+
+// ServeHTTP implements the API methods.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, basePath)
+
+	if strings.HasPrefix(method, "/files/download/") {
+		s.serveFile(w, r, strings.TrimPrefix(method, "/files/download/"))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:     method,
+		HTTPMethod: r.Method,
+		Query:      r.URL.Query(),
+		Header:     r.Header.Clone(),
+		Body:       body,
+	})
+
+	failure, failed := s.nextFailure(method)
+	s.mu.Unlock()
+
+	if failed {
+		writeFailure(w, failure)
+		return
+	}
+
+	q := r.URL.Query()
+	if s.Token != "" && q.Get("token") != s.Token {
+		writeFailure(w, Failure{StatusCode: http.StatusUnauthorized, Description: "Invalid token"})
+		return
+	}
+
+	switch method {
+	case "/self/get":
+		s.getSelf(w)
+	case "/events/get":
+		s.getEvents(w, r)
+	case "/messages/sendText":
+		s.sendMessage(w, q, "", false)
+	case "/messages/sendFile", "/messages/sendVoice":
+		s.sendFile(w, r, q)
+	case "/messages/editText":
+		s.editText(w, q)
+	case "/messages/deleteMessages":
+		s.deleteMessages(w, q)
+	case "/messages/answerCallbackQuery":
+		writeJSON(w, map[string]interface{}{"ok": true})
+	case "/chats/getInfo":
+		s.getChatInfo(w, q)
+	case "/chats/getAdmins":
+		s.getChatAdmins(w, q)
+	case "/chats/sendActions":
+		writeJSON(w, map[string]interface{}{"ok": true})
+	case "/files/getInfo":
+		s.getFileInfo(w, r, q)
+	default:
+		writeFailure(w, Failure{StatusCode: http.StatusNotFound, Description: "Method not found"})
+	}
+}
+
+// nextFailure pops the failure injected to the method. It must be called under the lock.
+func (s *Server) nextFailure(method string) (Failure, bool) {
+	fs := s.failures[method]
+	if len(fs) == 0 {
+		return Failure{}, false
+	}
+
+	s.failures[method] = fs[1:]
+
+	return fs[0], true
+}
+
+func (s *Server) getSelf(w http.ResponseWriter) {
+	s.mu.Lock()
+	self := s.self
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"ok":        true,
+		"userId":    self.UserID,
+		"nick":      self.Nick,
+		"firstName": self.FirstName,
+		"about":     self.About,
+		"photo":     []interface{}{},
+	})
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lastEventID, _ := strconv.Atoi(q.Get("lastEventId"))
+	pollTime, _ := strconv.Atoi(q.Get("pollTime"))
+
+	wait := time.Duration(pollTime) * time.Second
+	if wait > maxPollTime {
+		wait = maxPollTime
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		evs := make([]event.Event, 0)
+
+		for _, ev := range s.events {
+			if ev.EventID > lastEventID {
+				evs = append(evs, ev)
+			}
+		}
+
+		newEvents := s.newEvents
+		s.mu.Unlock()
+
+		if len(evs) > 0 {
+			writeJSON(w, map[string]interface{}{"ok": true, "events": evs})
+			return
+		}
+
+		select {
+		case <-newEvents:
+		case <-timer.C:
+			writeJSON(w, map[string]interface{}{"ok": true, "events": evs})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sendMessage stores the message sent to the chat and responds with its ID.
+func (s *Server) sendMessage(w http.ResponseWriter, q url.Values, fileID string, withFileID bool) {
+	if q.Get("chatId") == "" {
+		writeFailure(w, Failure{Description: "Missing required parameter chatId"})
+		return
+	}
+
+	s.mu.Lock()
+	m := &Message{
+		MessageID: s.nextID("msg"),
+		ChatID:    q.Get("chatId"),
+		Text:      q.Get("text"),
+		FileID:    fileID,
+		Caption:   q.Get("caption"),
+		Query:     q,
+	}
+	s.messages[m.MessageID] = m
+	s.order = append(s.order, m.MessageID)
+	s.mu.Unlock()
+
+	resp := map[string]interface{}{"ok": true, "msgId": m.MessageID}
+	if withFileID {
+		resp["fileId"] = fileID
+	}
+
+	writeJSON(w, resp)
+}
+
+// sendFile stores the file uploaded in the multipart form or checks the existing file.
+func (s *Server) sendFile(w http.ResponseWriter, r *http.Request, q url.Values) {
+	if r.Method != http.MethodPost {
+		fileID := q.Get("fileId")
+
+		if _, ok := s.File(fileID); !ok {
+			writeFailure(w, Failure{Description: "File not found"})
+			return
+		}
+
+		s.sendMessage(w, q, fileID, false)
+
+		return
+	}
+
+	f, h, err := r.FormFile("file")
+	if err != nil {
+		writeFailure(w, Failure{StatusCode: http.StatusBadRequest, Description: "Missing file"})
+		return
+	}
+
+	defer f.Close()
+
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeFailure(w, Failure{StatusCode: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+
+	fileType := "file"
+	if strings.HasSuffix(r.URL.Path, "/sendVoice") {
+		fileType = "voice"
+	}
+
+	fileID := s.AddFile(File{Type: fileType, Filename: h.Filename, Content: content})
+	s.sendMessage(w, q, fileID, true)
+}
+
+func (s *Server) editText(w http.ResponseWriter, q url.Values) {
+	s.mu.Lock()
+	m, ok := s.messages[q.Get("msgId")]
+	ok = ok && m.ChatID == q.Get("chatId")
+
+	if ok {
+		m.Text = q.Get("text")
+		m.Query = q
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeFailure(w, Failure{Description: "Message not found"})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"ok": true, "msgId": m.MessageID})
+}
+
+func (s *Server) deleteMessages(w http.ResponseWriter, q url.Values) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range q["msgId"] {
+		if m, ok := s.messages[id]; ok && m.ChatID == q.Get("chatId") {
+			delete(s.messages, id)
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{"ok": true})
+}
+
+func (s *Server) chat(w http.ResponseWriter, q url.Values) (Chat, bool) {
+	s.mu.Lock()
+	c, ok := s.chats[q.Get("chatId")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeFailure(w, Failure{Description: "Chat not found"})
+		return Chat{}, false
+	}
+
+	return *c, true
+}
+
+func (s *Server) getChatInfo(w http.ResponseWriter, q url.Values) {
+	c, ok := s.chat(w, q)
+	if !ok {
+		return
+	}
+
+	resp := map[string]interface{}{
+		"ok":     true,
+		"title":  c.Title,
+		"group":  c.Group,
+		"public": c.Public,
+	}
+
+	if c.InviteLink != "" {
+		resp["inviteLink"] = c.InviteLink
+	}
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) getChatAdmins(w http.ResponseWriter, q url.Values) {
+	c, ok := s.chat(w, q)
+	if !ok {
+		return
+	}
+
+	admins := make([]map[string]interface{}, 0, len(c.Admins))
+	for _, a := range c.Admins {
+		admins = append(admins, map[string]interface{}{"userId": a.UserID, "creator": a.IsCreator})
+	}
+
+	writeJSON(w, map[string]interface{}{"ok": true, "admins": admins})
+}
+
+func (s *Server) getFileInfo(w http.ResponseWriter, r *http.Request, q url.Values) {
+	f, ok := s.File(q.Get("fileId"))
+	if !ok {
+		writeFailure(w, Failure{Description: "File not found"})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"ok":       true,
+		"type":     f.Type,
+		"size":     len(f.Content),
+		"filename": f.Filename,
+		"url":      "http://" + r.Host + basePath + "/files/download/" + url.PathEscape(f.FileID),
+	})
+}
+
+// serveFile serves the content of the file supporting range requests.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, fileID string) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:     "/files/download",
+		HTTPMethod: r.Method,
+		Query:      r.URL.Query(),
+		Header:     r.Header.Clone(),
+	})
+
+	failure, failed := s.nextFailure("/files/download")
+	s.mu.Unlock()
+
+	if failed {
+		writeFailure(w, failure)
+		return
+	}
+
+	id, _ := url.PathUnescape(fileID)
+
+	f, ok := s.File(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, f.Filename, time.Time{}, bytes.NewReader(f.Content))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFailure(w http.ResponseWriter, f Failure) {
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((f.RetryAfter+time.Second-1)/time.Second)))
+	}
+
+	status := f.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "description": f.Description})
+}
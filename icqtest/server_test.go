@@ -0,0 +1,172 @@
+package icqtest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"icqbotapi"
+	"icqbotapi/event"
+	"icqbotapi/icqtest"
+)
+
+func newBot(srv *icqtest.Server) *icqbotapi.Bot {
+	return icqbotapi.NewWithOptions(srv.Token,
+		icqbotapi.WithBaseURL(srv.URL()),
+		icqbotapi.WithHTTPClient(srv.Client()),
+		icqbotapi.WithRetryPolicy(icqbotapi.NoRetry),
+		icqbotapi.WithLogger(icqbotapi.NopLogger),
+	)
+}
+
+func TestServer_messages(t *testing.T) {
+	srv := icqtest.NewServer()
+	defer srv.Close()
+
+	bot := newBot(srv)
+	ctx := context.Background()
+
+	sent, err := bot.SendText(ctx, &icqbotapi.SendTextRequest{ChatID: "chat1", Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bot.EditMessage(ctx, &icqbotapi.EditMessageRequest{
+		ChatID: "chat1", MessageID: sent.MessageID, Text: "hello!",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := srv.Messages("chat1")
+	if len(msgs) != 1 || msgs[0].Text != "hello!" {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+
+	if _, err := bot.DeleteMessage(ctx, &icqbotapi.DeleteMessageRequest{ChatID: "chat1", MessageID: sent.MessageID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs := srv.Messages("chat1"); len(msgs) != 0 {
+		t.Fatalf("message is not deleted: %+v", msgs)
+	}
+
+	_, err = bot.EditMessage(ctx, &icqbotapi.EditMessageRequest{ChatID: "chat1", MessageID: sent.MessageID, Text: "hi"})
+	if !icqbotapi.IsNotFound(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reqs := srv.RequestsTo("/messages/sendText")
+	if len(reqs) != 1 || reqs[0].Query.Get("text") != "hello" {
+		t.Fatalf("unexpected requests: %+v", reqs)
+	}
+}
+
+func TestServer_files(t *testing.T) {
+	srv := icqtest.NewServer()
+	defer srv.Close()
+
+	bot := newBot(srv)
+	ctx := context.Background()
+
+	req := &icqbotapi.SendNewFileRequest{
+		FileMessage: icqbotapi.FileMessage{ChatID: "chat1", Caption: "a file"},
+		File:        strings.NewReader("content"),
+		Filename:    "a.txt",
+	}
+
+	resp, err := bot.SendNewFile(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, ok := srv.File(resp.FileID); !ok || string(f.Content) != "content" || f.Filename != "a.txt" {
+		t.Fatalf("unexpected file: %+v", f)
+	}
+
+	info, err := bot.GetFileInfo(ctx, icqbotapi.FileID(resp.FileID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size != 7 || info.Filename != "a.txt" {
+		t.Fatalf("unexpected file info: %+v", info)
+	}
+
+	httpResp, err := srv.Client().Get(info.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", httpResp.StatusCode)
+	}
+}
+
+func TestServer_failures(t *testing.T) {
+	srv := icqtest.NewServer()
+	defer srv.Close()
+
+	bot := newBot(srv)
+	ctx := context.Background()
+
+	srv.Fail("/self/get", icqtest.Failure{StatusCode: http.StatusTooManyRequests})
+
+	if _, err := bot.GetSelf(ctx); !icqbotapi.IsRateLimited(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := bot.GetSelf(ctx); err != nil {
+		t.Fatalf("failure is injected more than once: %v", err)
+	}
+
+	if _, err := icqbotapi.NewWithOptions("wrong", icqbotapi.WithBaseURL(srv.URL()),
+		icqbotapi.WithRetryPolicy(icqbotapi.NoRetry)).GetSelf(ctx); !icqbotapi.IsForbidden(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := len(srv.Requests()); n != 3 {
+		t.Fatalf("unexpected number of requests: %d", n)
+	}
+}
+
+func TestServer_events(t *testing.T) {
+	srv := icqtest.NewServer()
+	defer srv.Close()
+
+	bot := newBot(srv)
+	handled := make(chan string, 2)
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		handled <- e.Text
+	})
+
+	bot.HandleEvents(context.Background())
+	defer bot.Stop()
+
+	srv.PushNewMessage("chat1", "user1", "first")
+
+	select {
+	case text := <-handled:
+		if text != "first" {
+			t.Fatalf("unexpected text: %s", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event is not handled")
+	}
+
+	// the event pushed while the bot is waiting for events is delivered immediately.
+	srv.PushNewMessage("chat1", "user1", "second")
+
+	select {
+	case text := <-handled:
+		if text != "second" {
+			t.Fatalf("unexpected text: %s", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event is not handled")
+	}
+}
@@ -0,0 +1,70 @@
+package icqbotapi
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/mailru/easyjson"
+)
+
+//easyjson:json
+// Button represents the button of inline keyboard.
+// The button either sends the callback data to the bot or opens the URL.
+type Button struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callbackData,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// CallbackButton creates the button which sends the callback query with the data to the bot.
+func CallbackButton(text, data string) Button {
+	return Button{
+		Text:         text,
+		CallbackData: data,
+	}
+}
+
+// URLButton creates the button which opens the URL.
+func URLButton(text, u string) Button {
+	return Button{
+		Text: text,
+		URL:  u,
+	}
+}
+
+//easyjson:json
+// InlineKeyboard represents the rows of buttons attached to the message.
+type InlineKeyboard [][]Button
+
+// NewInlineKeyboard creates the empty inline keyboard.
+func NewInlineKeyboard() InlineKeyboard {
+	return InlineKeyboard{}
+}
+
+// Row returns the keyboard with the row of buttons added.
+func (k InlineKeyboard) Row(buttons ...Button) InlineKeyboard {
+	return append(k, buttons)
+}
+
+func (k InlineKeyboard) checkFields(v *validator) {
+	for i, row := range k {
+		field := "InlineKeyboard[" + strconv.Itoa(i) + "]"
+		v.check(len(row) > 0, field, "cannot be empty")
+
+		for j, b := range row {
+			field := field + "[" + strconv.Itoa(j) + "]"
+			v.check(b.Text != "", field, "requires Text")
+			v.check((b.CallbackData == "") != (b.URL == ""), field, "requires either CallbackData or URL")
+		}
+	}
+}
+
+func (k InlineKeyboard) contributeToQuery(q url.Values) {
+	if len(k) == 0 {
+		return
+	}
+
+	// the keyboard consists of strings only, so marshaling cannot fail.
+	p, _ := easyjson.Marshal(k)
+	q.Set("inlineKeyboardMarkup", string(p))
+}
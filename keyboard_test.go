@@ -0,0 +1,89 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"icqbotapi/event"
+)
+
+func TestInlineKeyboard_contributeToQuery(t *testing.T) {
+	k := NewInlineKeyboard().
+		Row(CallbackButton("Approve", "approve:1"), CallbackButton("Reject", "reject:1")).
+		Row(URLButton("Open", "https://example.com"))
+
+	q := url.Values{}
+	k.contributeToQuery(q)
+
+	want := `[[{"text":"Approve","callbackData":"approve:1"},{"text":"Reject","callbackData":"reject:1"}],` +
+		`[{"text":"Open","url":"https://example.com"}]]`
+	if got := q.Get("inlineKeyboardMarkup"); got != want {
+		t.Fatalf("unexpected markup: %s", got)
+	}
+}
+
+func TestInlineKeyboard_validate(t *testing.T) {
+	req := &SendTextRequest{
+		ChatID:         "chat1",
+		Text:           "text",
+		InlineKeyboard: NewInlineKeyboard().Row(Button{Text: "Both", CallbackData: "data", URL: "https://example.com"}).Row(),
+	}
+
+	var vErr *ValidationError
+	if err := req.validate(); !errors.As(err, &vErr) || len(vErr.Violations) != 2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBot_AnswerCallbackQuery(t *testing.T) {
+	var q url.Values
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		q = r.URL.Query()
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	})
+	defer done()
+
+	_, err := bot.AnswerCallbackQuery(context.Background(), &AnswerCallbackQueryRequest{
+		QueryID:   "query1",
+		Text:      "Approved",
+		ShowAlert: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Get("queryId") != "query1" || q.Get("text") != "Approved" || q.Get("showAlert") != "true" {
+		t.Fatalf("unexpected query: %v", q)
+	}
+}
+
+func TestBot_handleCallbackQuery(t *testing.T) {
+	bot := NewWithOptions("token", WithLogger(NopLogger))
+
+	var query event.CallbackQueryPayload
+	bot.SetCallbackQueryHandler(func(e event.CallbackQueryPayload) {
+		query = e
+	})
+
+	ev := event.Event{
+		EventID: 1,
+		Type:    event.KindCallbackQuery,
+		Payload: []byte(`{"queryId": "query1", "callbackData": "approve:1", "message": {"msgId": "1", "chat": {"chatId": "chat1"}}}`),
+	}
+
+	if ev.ChatID() != "chat1" {
+		t.Fatalf("unexpected chat id: %s", ev.ChatID())
+	}
+
+	if err := bot.dispatch(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if query.QueryID != "query1" || query.CallbackData != "approve:1" || query.Message.Chat.ChatID != "chat1" {
+		t.Fatalf("unexpected callback query: %#v", query)
+	}
+}
@@ -0,0 +1,130 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBotRunning is returned when the bot which is already polling or handling events is started.
+	ErrBotRunning = errors.New("bot is already running")
+	// ErrShutdownTimeout is returned when in-flight handlers have not finished within the shutdown timeout.
+	ErrShutdownTimeout = errors.New("shutdown timeout exceeded")
+)
+
+// defaultShutdownTimeout is the time given to in-flight handlers to finish on shutdown.
+const defaultShutdownTimeout = 30 * time.Second
+
+// botRun represents the single run of polling or handling events.
+type botRun struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	handlers sync.WaitGroup
+	err      error
+}
+
+// drain waits for in-flight handlers of the run to finish within the timeout.
+// Zero timeout means no limit.
+func (r *botRun) drain(timeout time.Duration) error {
+	finished := make(chan struct{})
+	go func() {
+		r.handlers.Wait()
+		close(finished)
+	}()
+
+	if timeout <= 0 {
+		<-finished
+		return nil
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-finished:
+		return nil
+	case <-t.C:
+		return ErrShutdownTimeout
+	}
+}
+
+// start switches the stopped bot to the state s.
+// It returns the new run and its context which is canceled on Stop.
+func (b *Bot) start(ctx context.Context, s botState) (context.Context, *botRun, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != botStateStopped {
+		return nil, nil, ErrBotRunning
+	}
+
+	run := &botRun{
+		done: make(chan struct{}),
+	}
+
+	ctx, run.cancel = context.WithCancel(ctx)
+	b.state = s
+	b.run = run
+
+	return ctx, run, nil
+}
+
+// finish returns the bot to the stopped state, so it can be started again.
+func (b *Bot) finish(run *botRun, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	run.cancel()
+	run.err = err
+	b.state = botStateStopped
+	close(run.done)
+}
+
+// Run handles events until the context is canceled or Stop is called.
+// It blocks until in-flight handlers finish or the shutdown timeout is exceeded.
+func (b *Bot) Run(ctx context.Context) error {
+	run, err := b.handleEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	<-run.done
+
+	return run.err
+}
+
+// Stop stops polling or handling events. It does not wait for in-flight handlers, use Wait for that.
+func (b *Bot) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.run != nil {
+		b.run.cancel()
+	}
+}
+
+// Wait blocks until the current run of the bot finishes.
+// It returns ErrShutdownTimeout if in-flight handlers have not finished within the shutdown timeout.
+func (b *Bot) Wait() error {
+	b.mu.Lock()
+	run := b.run
+	b.mu.Unlock()
+
+	if run == nil {
+		return nil
+	}
+
+	<-run.done
+
+	return run.err
+}
+
+// WithShutdownTimeout sets the time given to in-flight handlers to finish on shutdown.
+// Zero timeout means no limit.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(b *Bot) {
+		b.shutdownTimeout = d
+	}
+}
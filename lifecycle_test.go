@@ -0,0 +1,230 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+)
+
+// newEventsTestBot creates the bot polling the server which returns the events once.
+func newEventsTestBot(events string, opts ...Option) (*Bot, func()) {
+	var polled int32
+
+	return newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&polled, 1) == 1 {
+			_, _ = w.Write([]byte(`{"ok": true, "events": [` + events + `]}`))
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		_, _ = w.Write([]byte(`{"ok": true, "events": []}`))
+	}, opts...)
+}
+
+const testNewMessageEvent = `{"eventId": 1, "type": "newMessage", "payload": {"msgId": "1", "chat": {"chatId": "chat1"}, "text": "hi"}}`
+
+func TestBot_Run(t *testing.T) {
+	bot, done := newEventsTestBot(testNewMessageEvent)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := make(chan string, 1)
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		handled <- e.Text
+		cancel()
+	})
+
+	if err := bot.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if text := <-handled; text != "hi" {
+		t.Fatalf("unexpected text: %s", text)
+	}
+
+	// the stopped bot can be started again.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	if events := bot.PollEvents(ctx); events == nil {
+		t.Fatal("bot is not restarted")
+	}
+
+	if err := bot.Run(ctx); err != ErrBotRunning {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bot.Stop()
+
+	if err := bot.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBot_StopShutdownTimeout(t *testing.T) {
+	bot, done := newEventsTestBot(testNewMessageEvent, WithShutdownTimeout(10*time.Millisecond))
+	defer done()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		close(started)
+		<-release
+	})
+
+	bot.HandleEvents(context.Background())
+	<-started
+	bot.Stop()
+
+	if err := bot.Wait(); err != ErrShutdownTimeout {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBot_StopSkipsQueuedEvents(t *testing.T) {
+	offsets := NewMemoryOffsetStore()
+
+	bot, done := newEventsTestBot(testNewMessageEvent+
+		`, {"eventId": 2, "type": "newMessage", "payload": {"msgId": "2", "chat": {"chatId": "chat1"}}}`+
+		`, {"eventId": 3, "type": "newMessage", "payload": {"msgId": "3", "chat": {"chatId": "chat1"}}}`,
+		WithOffsetStore(offsets))
+	defer done()
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+
+	var handled int32
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		atomic.AddInt32(&handled, 1)
+		started <- struct{}{}
+		<-release
+	})
+
+	bot.HandleEvents(context.Background())
+	<-started
+	bot.Stop()
+	close(release)
+
+	if err := bot.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Fatalf("queued events are handled after stop: %d", n)
+	}
+
+	// the skipped events are delivered again after restart.
+	if id, _ := offsets.Load(context.Background()); id != 1 {
+		t.Fatalf("unexpected committed offset: %d", id)
+	}
+}
+
+func TestBot_pollMalformedResponse(t *testing.T) {
+	var polled int32
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&polled, 1) == 1 {
+			_, _ = w.Write([]byte(`{"events": [`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok": true, "events": [` + testNewMessageEvent + `]}`))
+	}, WithRetryPolicy(testRetryPolicy))
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		cancel()
+	})
+
+	bot.SetErrorHandler(func(err error) {
+		errs <- err
+	})
+
+	if err := bot.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("unexpected nil error")
+		}
+	default:
+		t.Fatal("decoding error is not reported")
+	}
+}
+
+func TestBot_contextHandlers(t *testing.T) {
+	bot, done := newEventsTestBot(testNewMessageEvent)
+	defer done()
+
+	errFailed := errors.New("failed")
+	errs := make(chan error, 1)
+	canceled := make(chan error, 1)
+
+	bot.SetErrorHandler(func(err error) {
+		errs <- err
+	})
+
+	bot.SetNewMessageContextHandler(func(ctx context.Context, b *Bot, e event.NewMessagePayload) error {
+		if b != bot {
+			t.Error("unexpected bot")
+		}
+
+		// the handler observes the shutdown.
+		b.Stop()
+		<-ctx.Done()
+		canceled <- ctx.Err()
+
+		return errFailed
+	})
+
+	if err := bot.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("unexpected context error: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if err != errFailed {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	default:
+		t.Fatal("handler error is not reported")
+	}
+
+	var deleted event.MessageDeletePayload
+
+	bot.SetDeleteMessageContextHandler(func(ctx context.Context, b *Bot, e event.MessageDeletePayload) error {
+		deleted = e
+		return nil
+	})
+
+	ev := event.Event{EventID: 2, Type: event.KindDeletedMessage, Payload: []byte(`{"msgId": "2"}`)}
+	if err := bot.dispatch(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted.MessageID != "2" {
+		t.Fatalf("unexpected payload: %#v", deleted)
+	}
+}
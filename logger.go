@@ -0,0 +1,101 @@
+package icqbotapi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel represents the severity of log record.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Keys of structured log fields written by the bot.
+const (
+	LogKeyEventID   = "event_id"
+	LogKeyEventKind = "event_kind"
+	LogKeyChatID    = "chat_id"
+	LogKeyMethod    = "method"
+	LogKeyLatency   = "latency"
+	LogKeyStatus    = "status"
+	LogKeyAttempt   = "attempt"
+	LogKeyError     = "error"
+	LogKeyStack     = "stack"
+)
+
+// LogField represents the key-value pair of structured log record.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the structured leveled logger used by the bot.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// NopLogger is the Logger which discards all records.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(LogLevel, string, ...LogField) {}
+
+type stdLogger struct {
+	l        *log.Logger
+	minLevel LogLevel
+}
+
+// NewStdLogger creates the Logger which writes records of minLevel and above
+// to the standard logger in the "LEVEL message key=value" format.
+func NewStdLogger(l *log.Logger, minLevel LogLevel) Logger {
+	return &stdLogger{
+		l:        l,
+		minLevel: minLevel,
+	}
+}
+
+func (s *stdLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if level < s.minLevel {
+		return
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(level.String())
+	sb.WriteByte(' ')
+	sb.WriteString(msg)
+
+	for _, f := range fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Key, f.Value)
+	}
+
+	s.l.Print(sb.String())
+}
+
+// WithLogger sets the logger of polling, dispatching and request execution.
+func WithLogger(l Logger) Option {
+	return func(b *Bot) {
+		b.logger = l
+	}
+}
@@ -0,0 +1,88 @@
+package icqbotapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []string
+	fields  []map[string]interface{}
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		m[f.Key] = f.Value
+	}
+
+	l.records = append(l.records, level.String()+" "+msg)
+	l.fields = append(l.fields, m)
+}
+
+func TestNewStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewStdLogger(log.New(buf, "", 0), LogLevelInfo)
+
+	l.Log(LogLevelDebug, "skipped")
+	l.Log(LogLevelWarn, "unexpected event kind", LogField{LogKeyEventID, 1}, LogField{LogKeyEventKind, "kind"})
+
+	if got, want := buf.String(), "WARN unexpected event kind event_id=1 event_kind=kind\n"; got != want {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
+
+func TestBot_logRequest(t *testing.T) {
+	l := &recordingLogger{}
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	}, WithLogger(l))
+	defer done()
+
+	if _, err := bot.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.records) != 1 || l.records[0] != "DEBUG api request" {
+		t.Fatalf("unexpected records: %v", l.records)
+	}
+
+	f := l.fields[0]
+	if f[LogKeyMethod] != "/messages/sendText" || f[LogKeyChatID] != "chat1" || f[LogKeyStatus] != http.StatusOK {
+		t.Fatalf("unexpected fields: %v", f)
+	}
+}
+
+func TestBot_logRequestRedactsToken(t *testing.T) {
+	l := &recordingLogger{}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	bot := NewWithOptions("secret-token",
+		WithBaseURL(srv.URL+"/bot/v1"),
+		WithRetryPolicy(NoRetry),
+		WithLogger(l),
+	)
+
+	_, err := bot.GetChatInfo(context.Background(), "chat1")
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(l.fields) != 1 || strings.Contains(fmt.Sprint(l.fields[0][LogKeyError]), "secret-token") {
+		t.Fatalf("token is logged: %v", l.fields)
+	}
+}
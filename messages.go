@@ -1,22 +1,20 @@
 package icqbotapi
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/mailru/easyjson/opt"
 
-	"github.com/mailru/easyjson"
+	"icqbotapi/format"
+	"icqbotapi/voice"
 )
 
-var errValidation = errors.New("validation error")
-
 // SendSendTextRequest represents plain text interaction request.
 type SendTextRequest struct {
 	ChatID           string
@@ -24,50 +22,85 @@ type SendTextRequest struct {
 	ReplyMessageID   uint64
 	ForwardChatID    string
 	ForwardMessageID uint64
+	InlineKeyboard   InlineKeyboard
+	// ParseMode makes the server render the markup of the text. The text is sent as is if the mode is empty.
+	ParseMode format.Mode
 }
 
 func (r *SendTextRequest) validate() error {
-	if r.ChatID == "" {
-		return errValidation
-	}
+	v := &validator{}
+	r.checkFields(v)
+
+	return v.err()
+}
 
+func (r *SendTextRequest) checkFields(v *validator) {
+	v.check(r.ChatID != "", "ChatID", "is required")
+	checkReplyForward(v, r.ReplyMessageID, r.ForwardChatID, r.ForwardMessageID)
+	checkMarkup(v, r.ParseMode, "Text", r.Text)
+	r.InlineKeyboard.checkFields(v)
+}
+
+// checkReplyForward checks that the message either replies to or forwards the message.
+func checkReplyForward(v *validator, replyMessageID uint64, forwardChatID string, forwardMessageID uint64) {
 	// id цитируемого сообщения не может быть передано одновременно с forwardChatId и forwardMsgId.
-	if r.ReplyMessageID != 0 &&
-		(r.ForwardChatID != "" || r.ForwardMessageID != 0) {
-		return errValidation
+	if replyMessageID != 0 {
+		v.check(forwardChatID == "", "ReplyMessageID", "cannot be combined with ForwardChatID")
+		v.check(forwardMessageID == 0, "ReplyMessageID", "cannot be combined with ForwardMessageID")
 	}
 
-	// id чата, из которого будет переслано сообщение передается только с forwardMsgId,
-	// не может быть передано с replyMsgId.
-	if r.ForwardChatID != "" &&
-		(r.ForwardMessageID == 0 || r.ReplyMessageID != 0) {
-		return errValidation
+	// id чата, из которого будет переслано сообщение передается только с forwardMsgId.
+	if forwardChatID != "" {
+		v.check(forwardMessageID != 0, "ForwardChatID", "requires ForwardMessageID")
 	}
 
-	// id пересылаемого сообщения передается только с forwardChatId,
-	// не может быть передано с replyMsgId.
-	if r.ForwardMessageID != 0 &&
-		(r.ForwardChatID == "" || r.ReplyMessageID != 0) {
-		return errValidation
+	// id пересылаемого сообщения передается только с forwardChatId.
+	if forwardMessageID != 0 {
+		v.check(forwardChatID != "", "ForwardMessageID", "requires ForwardChatID")
 	}
+}
 
-	return nil
+// checkMarkup checks that the parse mode is supported and the markup of the text is balanced.
+func checkMarkup(v *validator, mode format.Mode, field, text string) {
+	switch mode {
+	case "":
+		return
+	case format.ModeMarkdownV2, format.ModeHTML:
+	default:
+		v.check(false, "ParseMode", "must be either MarkdownV2 or HTML")
+		return
+	}
+
+	if err := format.Validate(mode, text); err != nil {
+		v.check(false, field, "has "+err.Error())
+	}
+}
+
+func contributeParseModeToQuery(q url.Values, mode format.Mode) {
+	if mode != "" {
+		q.Set("parseMode", string(mode))
+	}
 }
 
 func (r *SendTextRequest) contributeToQuery(q url.Values) {
 	q.Set("chatId", r.ChatID)
 	q.Set("text", r.Text)
+	contributeReplyForwardToQuery(q, r.ReplyMessageID, r.ForwardChatID, r.ForwardMessageID)
+	contributeParseModeToQuery(q, r.ParseMode)
+	r.InlineKeyboard.contributeToQuery(q)
+}
 
-	if r.ReplyMessageID != 0 {
-		q.Set("replyMsgId", strconv.FormatUint(r.ReplyMessageID, 10))
+func contributeReplyForwardToQuery(q url.Values, replyMessageID uint64, forwardChatID string, forwardMessageID uint64) {
+	if replyMessageID != 0 {
+		q.Set("replyMsgId", strconv.FormatUint(replyMessageID, 10))
 	}
 
-	if r.ForwardChatID != "" {
-		q.Set("forwardChatId", r.ForwardChatID)
+	if forwardChatID != "" {
+		q.Set("forwardChatId", forwardChatID)
 	}
 
-	if r.ForwardMessageID != 0 {
-		q.Set("forwardMsgId", strconv.FormatUint(r.ForwardMessageID, 10))
+	if forwardMessageID != 0 {
+		q.Set("forwardMsgId", strconv.FormatUint(forwardMessageID, 10))
 	}
 }
 
@@ -78,6 +111,10 @@ type StatusResponse struct {
 	Description opt.String `json:"description"`
 }
 
+func (r StatusResponse) status() (bool, string) {
+	return r.Ok, r.Description.V
+}
+
 //easyjson:json
 // StatusMessageIDResponse represents response status data for requests which deal with messages.
 type StatusMessageIDResponse struct {
@@ -109,7 +146,7 @@ func (b *Bot) SendText(ctx context.Context, r *SendTextRequest) (*StatusMessageI
 	defer httpResp.Body.Close()
 
 	resp := &StatusMessageIDResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -117,45 +154,112 @@ func (b *Bot) SendText(ctx context.Context, r *SendTextRequest) (*StatusMessageI
 	return resp, err
 }
 
-type fileRequest struct {
-	SendTextRequest
-	Caption string
+// FileMessage contains parameters of the message with the attached file,
+// which are common for sending files by ID, by reader and by local path.
+type FileMessage struct {
+	ChatID           string
+	Caption          string
+	ReplyMessageID   uint64
+	ForwardChatID    string
+	ForwardMessageID uint64
+	InlineKeyboard   InlineKeyboard
+	// ParseMode makes the server render the markup of the caption. The caption is sent as is if the mode is empty.
+	ParseMode format.Mode
+	// IsVoice sends the file with sendVoice, so it is shown as the voice message.
 	IsVoice bool
 }
 
-func (r *fileRequest) contributeToQuery(q url.Values) {
-	r.SendTextRequest.contributeToQuery(q)
+func (r *FileMessage) checkFields(v *validator) {
+	v.check(r.ChatID != "", "ChatID", "is required")
+	checkReplyForward(v, r.ReplyMessageID, r.ForwardChatID, r.ForwardMessageID)
+	checkMarkup(v, r.ParseMode, "Caption", r.Caption)
+	r.InlineKeyboard.checkFields(v)
+}
+
+func (r *FileMessage) contributeToQuery(q url.Values) {
+	q.Set("chatId", r.ChatID)
 	q.Set("caption", r.Caption)
+	contributeReplyForwardToQuery(q, r.ReplyMessageID, r.ForwardChatID, r.ForwardMessageID)
+	contributeParseModeToQuery(q, r.ParseMode)
+	r.InlineKeyboard.contributeToQuery(q)
+}
+
+func (r *FileMessage) method() string {
+	if r.IsVoice {
+		return "/messages/sendVoice"
+	}
+
+	return "/messages/sendFile"
 }
 
 // SendFileRequest presents request with plain text with attached existing file/voice.
 type SendFileRequest struct {
-	fileRequest
+	FileMessage
 	FileID string
 }
 
-func (r *SendFileRequest) validate() error {
-	if err := r.fileRequest.validate(); err != nil {
-		return err
+// NewSendFileRequest creates the request to send the file uploaded before by its ID to the chat.
+func NewSendFileRequest(chatID, fileID string) *SendFileRequest {
+	return &SendFileRequest{
+		FileMessage: FileMessage{ChatID: chatID},
+		FileID:      fileID,
 	}
+}
 
-	if r.FileID == "" {
-		return errValidation
-	}
+func (r *SendFileRequest) validate() error {
+	v := &validator{}
+	r.checkFields(v)
+	v.check(r.FileID != "", "FileID", "is required")
 
-	return nil
+	return v.err()
 }
 
 func (r *SendFileRequest) contributeToQuery(q url.Values) {
-	r.fileRequest.contributeToQuery(q)
+	r.FileMessage.contributeToQuery(q)
 	q.Set("fileId", r.FileID)
 }
 
 // SendNewFileRequest presents request with plain text with attached new file/voice.
+// The file is either read from File or opened at Path.
 type SendNewFileRequest struct {
-	fileRequest
-	File     io.Reader
+	FileMessage
+	// File is streamed to the server. The request is repeated on failures only if the file is io.Seeker.
+	File io.Reader
+	// Path is the path of the local file, which is opened and closed by SendNewFile.
+	Path string
+	// Filename is the name of the file shown in the chat. It defaults to the base name of Path.
 	Filename string
+	// Progress is called with the number of bytes of the file sent and the size of the file,
+	// which is -1 if the file is not io.Seeker.
+	Progress func(sent, total int64)
+	// SkipVoiceCheck disables the check of the voice file format before sending.
+	SkipVoiceCheck bool
+}
+
+// NewSendNewFileRequest creates the request to upload the file read from the reader to the chat.
+func NewSendNewFileRequest(chatID string, file io.Reader, filename string) *SendNewFileRequest {
+	return &SendNewFileRequest{
+		FileMessage: FileMessage{ChatID: chatID},
+		File:        file,
+		Filename:    filename,
+	}
+}
+
+// NewSendLocalFileRequest creates the request to upload the local file at the path to the chat.
+func NewSendLocalFileRequest(chatID, path string) *SendNewFileRequest {
+	return &SendNewFileRequest{
+		FileMessage: FileMessage{ChatID: chatID},
+		Path:        path,
+	}
+}
+
+func (r *SendNewFileRequest) validate() error {
+	v := &validator{}
+	r.checkFields(v)
+	v.check(r.File != nil || r.Path != "", "File", "is required")
+	v.check(r.File == nil || r.Path == "", "Path", "cannot be combined with File")
+
+	return v.err()
 }
 
 // SendFile provides the function of sending text messages with already downloaded file attachments.
@@ -164,12 +268,7 @@ func (b *Bot) SendFile(ctx context.Context, r *SendFileRequest) (*StatusMessageI
 		return nil, err
 	}
 
-	m := "/messages/sendFile"
-	if r.IsVoice {
-		m = "/messages/sendVoice"
-	}
-
-	req, err := http.NewRequest(http.MethodGet, b.apiBaseURL+m, nil)
+	req, err := http.NewRequest(http.MethodGet, b.apiBaseURL+r.method(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -186,7 +285,7 @@ func (b *Bot) SendFile(ctx context.Context, r *SendFileRequest) (*StatusMessageI
 	defer httpResp.Body.Close()
 
 	resp := &StatusMessageIDResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -199,47 +298,103 @@ func (b *Bot) SendFile(ctx context.Context, r *SendFileRequest) (*StatusMessageI
 type SendNewFileResponse struct {
 	StatusMessageIDResponse
 	FileID string `json:"fileId"`
+	// Voice contains properties of the sent voice file if it was checked before sending.
+	Voice *voice.Info `json:"-"`
 }
 
 // SendNewFile provides the function of sending text messages with file attachments.
+// The seekable voice file is checked to be OGG/Opus before sending, so it is not shown as the generic attachment.
+// The check fails with the error matching voice.ErrInvalidVoice.
 func (b *Bot) SendNewFile(ctx context.Context, r *SendNewFileRequest) (*SendNewFileResponse, error) {
 	if err := r.validate(); err != nil {
 		return nil, err
 	}
 
-	buf := &bytes.Buffer{}
-	mw := multipart.NewWriter(buf)
+	if r.Path != "" {
+		f, err := os.Open(r.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
 
-	part, err := mw.CreateFormFile("file", r.Filename)
+		// the request of the caller is not modified.
+		opened := *r
+		opened.File, opened.Path = f, ""
+
+		if opened.Filename == "" {
+			opened.Filename = filepath.Base(r.Path)
+		}
+
+		r = &opened
+	}
+
+	// the size of the seekable file is checked before it is read for the voice check or the hash.
+	upload, err := newMultipartUpload(r.File, r.Filename, b.maxUploadSize, r.Progress)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err = io.Copy(part, r.File); err != nil {
-		return nil, err
+	var voiceInfo *voice.Info
+
+	if f, ok := r.File.(io.ReadSeeker); ok && r.IsVoice && !r.SkipVoiceCheck {
+		info, err := checkVoice(f)
+		if err != nil {
+			return nil, err
+		}
+
+		voiceInfo = info
 	}
 
-	//nolint:govet
-	if err := mw.Close(); err != nil {
-		return nil, err
+	hash := ""
+
+	if f, ok := r.File.(io.ReadSeeker); ok && b.uploadCache != nil {
+		h, err := hashContent(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if h != "" {
+			if resp, err := b.sendCachedFile(ctx, r, h); resp != nil || err != nil {
+				if resp != nil {
+					resp.Voice = voiceInfo
+				}
+
+				return resp, err
+			}
+		}
+
+		hash = h
 	}
 
-	m := "/messages/sendFile"
-	if r.IsVoice {
-		m = "/messages/sendVoice"
+	body, err := upload.open()
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, b.apiBaseURL+m, buf)
+	req, err := http.NewRequest(http.MethodPost, b.apiBaseURL+r.method(), body)
 	if err != nil {
+		upload.close()
 		return nil, err
 	}
 
 	q := req.URL.Query()
 	r.contributeToQuery(q)
 	req.URL.RawQuery = q.Encode()
-	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Content-Type", upload.contentType())
+	req.ContentLength = upload.contentLength()
+
+	if upload.seekable {
+		req.GetBody = upload.open
+	}
 
 	httpResp, err := b.doRequest(ctx, req)
+
+	// the streaming error, e.g. ErrFileTooLarge, is the cause of the request failure.
+	if uploadErr := upload.close(); uploadErr != nil && err != nil {
+		return nil, uploadErr
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -247,36 +402,59 @@ func (b *Bot) SendNewFile(ctx context.Context, r *SendNewFileRequest) (*SendNewF
 	defer httpResp.Body.Close()
 
 	resp := &SendNewFileResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp, err
+	if hash != "" && resp.FileID != "" {
+		if err := b.uploadCache.Set(ctx, hash, resp.FileID); err != nil {
+			b.logUploadCacheError(err)
+		}
+	}
+
+	resp.Voice = voiceInfo
+
+	return resp, nil
+}
+
+// checkVoice checks that the seekable voice file is played by clients as the voice message.
+// It returns nil info if the file cannot seek, e.g. it is the pipe, so it is sent unchecked.
+func checkVoice(f io.ReadSeeker) (*voice.Info, error) {
+	if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+		return nil, nil
+	}
+
+	return voice.InspectAndValidate(f)
 }
 
 //easyjson:json
 // EditMessageRequest represents data for editing a messages.
 type EditMessageRequest struct {
-	ChatID    string `json:"chatId"`
-	MessageID string `json:"msgId"`
-	Text      string `json:"text"`
+	ChatID         string         `json:"chatId"`
+	MessageID      string         `json:"msgId"`
+	Text           string         `json:"text"`
+	InlineKeyboard InlineKeyboard `json:"inlineKeyboardMarkup"`
+	ParseMode      format.Mode    `json:"parseMode,omitempty"`
 }
 
 func (r *EditMessageRequest) validate() error {
-	if r.ChatID == "" ||
-		r.MessageID == "" ||
-		r.Text == "" {
-		return errValidation
-	}
-
-	return nil
+	v := &validator{}
+	v.check(r.ChatID != "", "ChatID", "is required")
+	v.check(r.MessageID != "", "MessageID", "is required")
+	v.check(r.Text != "", "Text", "is required")
+	checkMarkup(v, r.ParseMode, "Text", r.Text)
+	r.InlineKeyboard.checkFields(v)
+
+	return v.err()
 }
 
 func (r *EditMessageRequest) contributeToQuery(q url.Values) {
 	q.Set("chatId", r.ChatID)
 	q.Set("msgId", r.MessageID)
 	q.Set("text", r.Text)
+	contributeParseModeToQuery(q, r.ParseMode)
+	r.InlineKeyboard.contributeToQuery(q)
 }
 
 //nolint:dupl
@@ -303,7 +481,7 @@ func (b *Bot) EditMessage(ctx context.Context, r *EditMessageRequest) (*StatusMe
 	defer httpResp.Body.Close()
 
 	resp := &StatusMessageIDResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -319,12 +497,11 @@ type DeleteMessageRequest struct {
 }
 
 func (r *DeleteMessageRequest) validate() error {
-	if r.ChatID == "" ||
-		r.MessageID == "" {
-		return errValidation
-	}
+	v := &validator{}
+	v.check(r.ChatID != "", "ChatID", "is required")
+	v.check(r.MessageID != "", "MessageID", "is required")
 
-	return nil
+	return v.err()
 }
 
 func (r *DeleteMessageRequest) contributeToQuery(q url.Values) {
@@ -356,7 +533,70 @@ func (b *Bot) DeleteMessage(ctx context.Context, r *DeleteMessageRequest) (*Stat
 	defer httpResp.Body.Close()
 
 	resp := &StatusResponse{}
-	err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
+	err = b.decodeResponse(httpResp, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, err
+}
+
+// AnswerCallbackQueryRequest represents the answer to the callback query of inline keyboard button.
+type AnswerCallbackQueryRequest struct {
+	QueryID   string
+	Text      string
+	ShowAlert bool
+	URL       string
+}
+
+func (r *AnswerCallbackQueryRequest) validate() error {
+	v := &validator{}
+	v.check(r.QueryID != "", "QueryID", "is required")
+
+	return v.err()
+}
+
+func (r *AnswerCallbackQueryRequest) contributeToQuery(q url.Values) {
+	q.Set("queryId", r.QueryID)
+
+	if r.Text != "" {
+		q.Set("text", r.Text)
+	}
+
+	if r.ShowAlert {
+		q.Set("showAlert", "true")
+	}
+
+	if r.URL != "" {
+		q.Set("url", r.URL)
+	}
+}
+
+//nolint:dupl
+// AnswerCallbackQuery answers the callback query showing the notification or alert to the user.
+func (b *Bot) AnswerCallbackQuery(ctx context.Context, r *AnswerCallbackQueryRequest) (*StatusResponse, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, b.apiBaseURL+"/messages/answerCallbackQuery", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	r.contributeToQuery(q)
+	req.URL.RawQuery = q.Encode()
+
+	httpResp, err := b.doRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer httpResp.Body.Close()
+
+	resp := &StatusResponse{}
+	err = b.decodeResponse(httpResp, resp)
 	if err != nil {
 		return nil, err
 	}
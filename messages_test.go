@@ -2,11 +2,181 @@ package icqbotapi
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"icqbotapi/format"
 )
 
+func TestSendTextRequest_validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  SendTextRequest
+		want []FieldViolation
+	}{
+		{
+			name: "valid",
+			req:  SendTextRequest{ChatID: "chat1", Text: "text"},
+		},
+		{
+			name: "missing chat",
+			req:  SendTextRequest{Text: "text"},
+			want: []FieldViolation{
+				{Field: "ChatID", Rule: "is required"},
+			},
+		},
+		{
+			name: "reply with forward",
+			req:  SendTextRequest{ChatID: "chat1", ReplyMessageID: 1, ForwardChatID: "chat2", ForwardMessageID: 2},
+			want: []FieldViolation{
+				{Field: "ReplyMessageID", Rule: "cannot be combined with ForwardChatID"},
+				{Field: "ReplyMessageID", Rule: "cannot be combined with ForwardMessageID"},
+			},
+		},
+		{
+			name: "forward without message",
+			req:  SendTextRequest{ForwardChatID: "chat2"},
+			want: []FieldViolation{
+				{Field: "ChatID", Rule: "is required"},
+				{Field: "ForwardChatID", Rule: "requires ForwardMessageID"},
+			},
+		},
+		{
+			name: "balanced markup",
+			req:  SendTextRequest{ChatID: "chat1", Text: "*bold* _italic_", ParseMode: format.ModeMarkdownV2},
+		},
+		{
+			name: "unbalanced markup",
+			req:  SendTextRequest{ChatID: "chat1", Text: "<b>bold", ParseMode: format.ModeHTML},
+			want: []FieldViolation{
+				{Field: "Text", Rule: "has invalid HTML markup at offset 0: unclosed <b>"},
+			},
+		},
+		{
+			name: "empty tag",
+			req:  SendTextRequest{ChatID: "chat1", Text: "1 <> 2", ParseMode: format.ModeHTML},
+			want: []FieldViolation{
+				{Field: "Text", Rule: "has invalid HTML markup at offset 2: empty tag <>"},
+			},
+		},
+		{
+			name: "unknown parse mode",
+			req:  SendTextRequest{ChatID: "chat1", Text: "text", ParseMode: "Markdown"},
+			want: []FieldViolation{
+				{Field: "ParseMode", Rule: "must be either MarkdownV2 or HTML"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrValidation) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var vErr *ValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+
+			if !reflect.DeepEqual(vErr.Violations, tt.want) {
+				t.Fatalf("unexpected violations: %v", vErr.Violations)
+			}
+		})
+	}
+}
+
+func TestSendNewFileRequest_validate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *SendNewFileRequest
+		want []FieldViolation
+	}{
+		{
+			name: "reader",
+			req:  NewSendNewFileRequest("chat1", strings.NewReader("content"), "a.txt"),
+		},
+		{
+			name: "path",
+			req:  NewSendLocalFileRequest("chat1", "a.txt"),
+		},
+		{
+			name: "missing file",
+			req:  &SendNewFileRequest{FileMessage: FileMessage{ChatID: "chat1"}},
+			want: []FieldViolation{
+				{Field: "File", Rule: "is required"},
+			},
+		},
+		{
+			name: "reader with path",
+			req: &SendNewFileRequest{
+				FileMessage: FileMessage{ChatID: "chat1"},
+				File:        strings.NewReader("content"),
+				Path:        "a.txt",
+			},
+			want: []FieldViolation{
+				{Field: "Path", Rule: "cannot be combined with File"},
+			},
+		},
+		{
+			name: "reply with forward and unbalanced caption",
+			req: &SendNewFileRequest{
+				FileMessage: FileMessage{
+					ReplyMessageID:   1,
+					ForwardChatID:    "chat2",
+					ForwardMessageID: 2,
+					Caption:          "<b>bold",
+					ParseMode:        format.ModeHTML,
+				},
+				Path: "a.txt",
+			},
+			want: []FieldViolation{
+				{Field: "ChatID", Rule: "is required"},
+				{Field: "ReplyMessageID", Rule: "cannot be combined with ForwardChatID"},
+				{Field: "ReplyMessageID", Rule: "cannot be combined with ForwardMessageID"},
+				{Field: "Caption", Rule: "has invalid HTML markup at offset 0: unclosed <b>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			var vErr *ValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(vErr.Violations, tt.want) {
+				t.Fatalf("unexpected violations: %v", vErr.Violations)
+			}
+		})
+	}
+}
+
 func ExampleBot_SendText() {
 	const token = "001.1104030426.1757333006:757143498"
 	bot := New(token, http.DefaultClient, APITypeICQ)
@@ -25,16 +195,8 @@ func ExampleBot_SendFile() {
 	const token = "001.1104030426.1757333006:757143498"
 	bot := New(token, http.DefaultClient, APITypeICQ)
 
-	req := &SendFileRequest{
-		fileRequest: fileRequest{
-			SendTextRequest: SendTextRequest{
-				ChatID: "chat1",
-				Text:   "is's pepe",
-			},
-			Caption: "it's pepe",
-		},
-		FileID: "05j5L69UrfAdj8tZCGyi8H5d5160d61af",
-	}
+	req := NewSendFileRequest("chat1", "05j5L69UrfAdj8tZCGyi8H5d5160d61af")
+	req.Caption = "it's pepe"
 
 	resp, _ := bot.SendFile(context.Background(), req)
 
@@ -45,24 +207,9 @@ func ExampleBot_SendNewFile() {
 	const token = "001.1104030426.1757333006:757143498"
 	bot := New(token, http.DefaultClient, APITypeICQ)
 
-	f, err := os.Open("./pepe.jpg")
-	if err != nil {
-		panic(err)
-	}
-
-	defer f.Close()
-
-	req := &SendNewFileRequest{
-		fileRequest: fileRequest{
-			SendTextRequest: SendTextRequest{
-				ChatID: "chat1",
-				Text:   "is's pepe",
-			},
-			Caption: "it's pepe",
-		},
-		File:     f,
-		Filename: "pepe.jpg",
-	}
+	req := NewSendLocalFileRequest("chat1", "./pepe.jpg")
+	req.Caption = "it's pepe"
+	req.ReplyMessageID = 6724288965706252425
 
 	resp, _ := bot.SendNewFile(context.Background(), req)
 
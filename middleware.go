@@ -0,0 +1,65 @@
+package icqbotapi
+
+import (
+	"context"
+
+	"icqbotapi/event"
+)
+
+// EventHandler handles the dispatched event of any kind.
+type EventHandler func(ctx context.Context, ev event.Event) error
+
+// Middleware wraps the event handler, e.g. to check access, log or throttle events.
+// The middleware short-circuits handling by returning without calling next.
+// The returned error is reported to the error handler and the event fails like the one whose handler
+// returned the error: it holds the offset unless the failure is handled WithDeadLetterHandler.
+type Middleware func(next EventHandler) EventHandler
+
+type contextKey int
+
+const (
+	contextKeyEvent contextKey = iota
+	contextKeyBot
+)
+
+// EventFromContext returns the event being dispatched by the bot.
+func EventFromContext(ctx context.Context) (event.Event, bool) {
+	ev, ok := ctx.Value(contextKeyEvent).(event.Event)
+	return ev, ok
+}
+
+// BotFromContext returns the bot dispatching the event.
+func BotFromContext(ctx context.Context) (*Bot, bool) {
+	b, ok := ctx.Value(contextKeyBot).(*Bot)
+	return b, ok
+}
+
+// Use adds middlewares wrapping every dispatched event regardless of its kind.
+// Middlewares are called in the order they are added, before middlewares added with UseFor.
+func (b *Bot) Use(mw ...Middleware) {
+	b.middlewares = append(b.middlewares, mw...)
+}
+
+// UseFor adds middlewares wrapping the handler of the event kind.
+// Middlewares are called in the order they are added.
+func (b *Bot) UseFor(kind event.Kind, mw ...Middleware) {
+	if b.kindMiddlewares == nil {
+		b.kindMiddlewares = make(map[event.Kind][]Middleware)
+	}
+
+	b.kindMiddlewares[kind] = append(b.kindMiddlewares[kind], mw...)
+}
+
+// chain wraps the handler of the event kind with middlewares, so the first added middleware is called first.
+func (b *Bot) chain(kind event.Kind, h EventHandler) EventHandler {
+	kindMws := b.kindMiddlewares[kind]
+	for i := len(kindMws) - 1; i >= 0; i-- {
+		h = kindMws[i](h)
+	}
+
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		h = b.middlewares[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,111 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"icqbotapi/event"
+)
+
+func TestBot_middleware(t *testing.T) {
+	bot, done := newTestBot(nil)
+	defer done()
+
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next EventHandler) EventHandler {
+			return func(ctx context.Context, ev event.Event) error {
+				calls = append(calls, name)
+				return next(ctx, ev)
+			}
+		}
+	}
+
+	bot.Use(record("global1"), record("global2"))
+	bot.UseFor(event.KindNewMessage, record("newMessage"))
+	bot.UseFor(event.KindNewMessage, func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev event.Event) error {
+			got, ok := EventFromContext(ctx)
+			if !ok || got.EventID != ev.EventID {
+				t.Errorf("unexpected event in context: %v", got)
+			}
+
+			if b, ok := BotFromContext(ctx); !ok || b != bot {
+				t.Error("bot is not in context")
+			}
+
+			// the messages of banned user are not handled.
+			if ev.Payload != nil && string(ev.Payload) == `{"from": {"userId": "banned"}}` {
+				return nil
+			}
+
+			return next(ctx, ev)
+		}
+	})
+
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		calls = append(calls, "handler")
+	})
+
+	ev := event.Event{EventID: 1, Type: event.KindNewMessage, Payload: []byte(`{"from": {"userId": "user1"}}`)}
+	if err := bot.dispatch(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"global1", "global2", "newMessage", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+
+	calls = nil
+	ev = event.Event{EventID: 2, Type: event.KindNewMessage, Payload: []byte(`{"from": {"userId": "banned"}}`)}
+
+	if err := bot.dispatch(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"global1", "global2", "newMessage"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("handling is not short-circuited: %v", calls)
+	}
+
+	calls = nil
+	ev = event.Event{EventID: 3, Type: event.KindPinnedMessage, Payload: []byte(`{}`)}
+
+	if err := bot.dispatch(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"global1", "global2"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+func TestBot_middlewareError(t *testing.T) {
+	bot, done := newTestBot(nil)
+	defer done()
+
+	errDenied := errors.New("denied")
+
+	bot.Use(func(next EventHandler) EventHandler {
+		return func(ctx context.Context, ev event.Event) error {
+			return errDenied
+		}
+	})
+
+	var reported error
+
+	bot.SetErrorHandler(func(err error) {
+		reported = err
+	})
+
+	ev := event.Event{EventID: 1, Type: event.KindNewMessage, Payload: []byte(`{}`)}
+	if err := bot.safeDispatch(context.Background(), ev); err != errDenied {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reported != errDenied {
+		t.Fatalf("error is not reported: %v", reported)
+	}
+}
@@ -0,0 +1,302 @@
+package icqbotapi
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"icqbotapi/event"
+)
+
+// OffsetStore persists the ID of the last handled event, so that the bot
+// continues polling from it after restart.
+type OffsetStore interface {
+	// Load returns the ID of the last handled event or zero if there is none.
+	Load(ctx context.Context) (int, error)
+	// Commit saves the ID of the last handled event.
+	Commit(ctx context.Context, eventID int) error
+}
+
+// MemoryOffsetStore is the OffsetStore which keeps the event ID in memory.
+type MemoryOffsetStore struct {
+	mu      sync.Mutex
+	eventID int
+}
+
+// NewMemoryOffsetStore creates the in-memory offset store.
+func NewMemoryOffsetStore() *MemoryOffsetStore {
+	return &MemoryOffsetStore{}
+}
+
+// Load returns the ID of the last handled event.
+func (s *MemoryOffsetStore) Load(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.eventID, nil
+}
+
+// Commit saves the ID of the last handled event.
+func (s *MemoryOffsetStore) Commit(_ context.Context, eventID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eventID = eventID
+
+	return nil
+}
+
+// FileOffsetStore is the OffsetStore which keeps the event ID in the file.
+type FileOffsetStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileOffsetStore creates the offset store which keeps the event ID in the file at the path.
+func NewFileOffsetStore(path string) *FileOffsetStore {
+	return &FileOffsetStore{
+		path: path,
+	}
+}
+
+// Load reads the ID of the last handled event from the file. It returns zero if the file does not exist.
+func (s *FileOffsetStore) Load(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(p)))
+}
+
+// Commit writes the ID of the last handled event to the file.
+// The file is replaced atomically, so it is never left partially written.
+func (s *FileOffsetStore) Commit(_ context.Context, eventID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeFileAtomic(s.path, []byte(strconv.Itoa(eventID)))
+}
+
+// writeFileAtomic writes the data to the temporary file and renames it to the path,
+// so the file at the path is never left partially written.
+func writeFileAtomic(path string, p []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(p); err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// KeyValueStore represents the generic key-value storage, e.g. Redis or etcd client.
+type KeyValueStore interface {
+	// Get returns the value of the key or nil if the key does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set sets the value of the key.
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+type kvOffsetStore struct {
+	kv  KeyValueStore
+	key string
+}
+
+// NewKVOffsetStore creates the offset store which keeps the event ID in the key-value storage under the key.
+func NewKVOffsetStore(kv KeyValueStore, key string) OffsetStore {
+	return &kvOffsetStore{
+		kv:  kv,
+		key: key,
+	}
+}
+
+func (s *kvOffsetStore) Load(ctx context.Context) (int, error) {
+	p, err := s.kv.Get(ctx, s.key)
+	if err != nil || p == nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(string(p))
+}
+
+func (s *kvOffsetStore) Commit(ctx context.Context, eventID int) error {
+	return s.kv.Set(ctx, s.key, []byte(strconv.Itoa(eventID)))
+}
+
+// offsetTracker tracks the events being handled and commits the event IDs.
+// The event ID is committed only when the event and all events received before it have been handled successfully,
+// which gives at-least-once delivery across restarts. The failed event holds the offset, so it and all events
+// received after it are delivered again after restart, unless the failure is handled WithDeadLetterHandler.
+type offsetTracker struct {
+	mu     sync.Mutex
+	commit func(eventID int)
+	// hold is called once with the ID of the failed event which holds the offset.
+	hold    func(eventID int)
+	pending []int
+	// outcomes maps IDs of finished events to whether they have been handled successfully.
+	outcomes map[int]bool
+	held     bool
+	// toCommit is the ID waiting to be committed, committed is the last committed ID.
+	toCommit   int
+	committed  int
+	committing bool
+}
+
+// newOffsetTracker creates the tracker of events received after the committed ID.
+func newOffsetTracker(committed int, commit func(eventID int), hold func(eventID int)) *offsetTracker {
+	return &offsetTracker{
+		commit:    commit,
+		hold:      hold,
+		outcomes:  make(map[int]bool),
+		toCommit:  committed,
+		committed: committed,
+	}
+}
+
+// add registers the received event. Events without ID, e.g. pushed to the webhook, are not tracked.
+func (t *offsetTracker) add(eventID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// nothing is committed after the failed event, so later events are not tracked.
+	if t.held || eventID == 0 {
+		return
+	}
+
+	t.pending = append(t.pending, eventID)
+}
+
+// done records the outcome of the event and commits the event ID if possible.
+// The commit is made outside the lock by one worker at a time, which commits the latest ID
+// marked by other workers meanwhile, so workers are not serialized by the store and the committed IDs never decrease.
+func (t *offsetTracker) done(eventID int, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.held || eventID == 0 {
+		return
+	}
+
+	t.outcomes[eventID] = ok
+
+	for len(t.pending) > 0 {
+		id := t.pending[0]
+
+		handled, finished := t.outcomes[id]
+		if !finished {
+			break
+		}
+
+		if !handled {
+			t.held = true
+			t.pending, t.outcomes = nil, nil
+
+			t.mu.Unlock()
+			t.hold(id)
+			t.mu.Lock()
+
+			break
+		}
+
+		// events pushed to the webhook out of order never move the offset back.
+		if id > t.toCommit {
+			t.toCommit = id
+		}
+
+		delete(t.outcomes, id)
+		t.pending = t.pending[1:]
+	}
+
+	if t.committing {
+		return
+	}
+
+	t.committing = true
+
+	for t.toCommit > t.committed {
+		id := t.toCommit
+
+		t.mu.Unlock()
+		t.commit(id)
+		t.mu.Lock()
+
+		t.committed = id
+	}
+
+	t.committing = false
+}
+
+// WithOffsetStore sets the store of the last handled event ID.
+func WithOffsetStore(s OffsetStore) Option {
+	return func(b *Bot) {
+		b.offsets = s
+	}
+}
+
+func (b *Bot) loadOffset(ctx context.Context) (int, error) {
+	if b.offsets == nil {
+		return 0, nil
+	}
+
+	return b.offsets.Load(ctx)
+}
+
+// WithDeadLetterHandler sets the handler of events which have failed, e.g. to save them for later processing.
+// The failed event passed to the handler is committed like the handled one, so it is not delivered again.
+// Without the handler the failed event holds the offset: neither it nor events received after it
+// are committed until restart, so they are delivered again.
+func WithDeadLetterHandler(fn func(ctx context.Context, ev event.Event, err error)) Option {
+	return func(b *Bot) {
+		b.deadLetterHandler = fn
+	}
+}
+
+// holdOffset reports the failed event which stops committing offsets until restart.
+func (b *Bot) holdOffset(eventID int) {
+	if b.offsets == nil {
+		return
+	}
+
+	b.logger.Log(LogLevelError, "event offset is held by the failed event until restart",
+		LogField{LogKeyEventID, eventID},
+	)
+}
+
+func (b *Bot) commitOffset(eventID int) {
+	if b.offsets == nil {
+		return
+	}
+
+	// the offset is committed even if the run is being stopped, so the context is not inherited.
+	if err := b.offsets.Commit(context.Background(), eventID); err != nil {
+		b.logger.Log(LogLevelError, "event offset commit failed",
+			LogField{LogKeyEventID, eventID},
+			LogField{LogKeyError, err},
+		)
+		b.handleError(err)
+	}
+}
@@ -0,0 +1,276 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+	"icqbotapi/icqtest"
+)
+
+func TestFileOffsetStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s := NewFileOffsetStore(filepath.Join(dir, "offset"))
+	ctx := context.Background()
+
+	if id, err := s.Load(ctx); err != nil || id != 0 {
+		t.Fatalf("unexpected offset: %d, %v", id, err)
+	}
+
+	if err := s.Commit(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := NewFileOffsetStore(filepath.Join(dir, "offset")).Load(ctx); err != nil || id != 42 {
+		t.Fatalf("unexpected offset: %d, %v", id, err)
+	}
+}
+
+type mapKeyValueStore map[string][]byte
+
+func (m mapKeyValueStore) Get(_ context.Context, key string) ([]byte, error) {
+	return m[key], nil
+}
+
+func (m mapKeyValueStore) Set(_ context.Context, key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func TestKVOffsetStore(t *testing.T) {
+	kv := mapKeyValueStore{}
+	s := NewKVOffsetStore(kv, "bot:offset")
+	ctx := context.Background()
+
+	if id, err := s.Load(ctx); err != nil || id != 0 {
+		t.Fatalf("unexpected offset: %d, %v", id, err)
+	}
+
+	if err := s.Commit(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(kv["bot:offset"]) != "7" {
+		t.Fatalf("unexpected value: %s", kv["bot:offset"])
+	}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	var committed, held []int
+
+	tr := newOffsetTracker(0, func(eventID int) {
+		committed = append(committed, eventID)
+	}, func(eventID int) {
+		held = append(held, eventID)
+	})
+	tr.add(1)
+	tr.add(2)
+	tr.add(3)
+
+	tr.done(2, true)
+	if len(committed) != 0 {
+		t.Fatal("event is committed before the previous one is handled")
+	}
+
+	tr.done(1, true)
+	if len(committed) != 1 || committed[0] != 2 {
+		t.Fatalf("unexpected commits: %v", committed)
+	}
+
+	tr.add(4)
+	tr.done(4, true)
+	// the failed event holds the offset, so it is delivered again after restart.
+	tr.done(3, false)
+	tr.add(5)
+	tr.done(5, true)
+
+	if len(committed) != 1 {
+		t.Fatalf("event is committed after the failed one: %v", committed)
+	}
+
+	if len(held) != 1 || held[0] != 3 {
+		t.Fatalf("unexpected held events: %v", held)
+	}
+}
+
+func TestOffsetTracker_commitOutsideLock(t *testing.T) {
+	var (
+		committed []int
+		blocked   = make(chan struct{})
+		release   = make(chan struct{})
+	)
+
+	tr := newOffsetTracker(0, func(eventID int) {
+		if eventID == 1 {
+			close(blocked)
+			<-release
+		}
+
+		committed = append(committed, eventID)
+	}, func(int) {})
+	tr.add(1)
+	tr.add(2)
+	tr.add(3)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		tr.done(1, true)
+	}()
+
+	<-blocked
+
+	// other workers are not blocked by the slow commit.
+	tr.done(2, true)
+	tr.done(3, true)
+
+	close(release)
+	<-finished
+
+	if len(committed) != 2 || committed[0] != 1 || committed[1] != 3 {
+		t.Fatalf("unexpected commits: %v", committed)
+	}
+}
+
+func TestBot_OffsetStoreAfterFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadLetter bool
+		wantOffset int
+	}{
+		{name: "held", wantOffset: 1},
+		{name: "dead letter", deadLetter: true, wantOffset: 3},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := icqtest.NewServer()
+			defer srv.Close()
+
+			var (
+				handled    int32
+				deadLetter []string
+				mu         sync.Mutex
+			)
+
+			offsets := NewMemoryOffsetStore()
+			opts := []Option{
+				WithBaseURL(srv.URL()),
+				WithHTTPClient(srv.Client()),
+				WithRetryPolicy(NoRetry),
+				WithLogger(NopLogger),
+				WithOffsetStore(offsets),
+			}
+
+			if tt.deadLetter {
+				opts = append(opts, WithDeadLetterHandler(func(_ context.Context, ev event.Event, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					deadLetter = append(deadLetter, strconv.Itoa(ev.EventID)+" "+err.Error())
+				}))
+			}
+
+			bot := NewWithOptions(srv.Token, opts...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			bot.SetNewMessageContextHandler(func(_ context.Context, _ *Bot, e event.NewMessagePayload) error {
+				defer atomic.AddInt32(&handled, 1)
+
+				if e.Text == "fail" {
+					return errors.New("failed")
+				}
+
+				return nil
+			})
+
+			for _, text := range []string{"ok", "fail", "ok"} {
+				srv.PushNewMessage("chat1", "user1", text)
+			}
+
+			runErr := make(chan error, 1)
+			go func() {
+				runErr <- bot.Run(ctx)
+			}()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&handled) < 3 {
+				if time.Now().After(deadline) {
+					t.Fatal("events are not handled")
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			cancel()
+
+			if err := <-runErr; err != nil {
+				t.Fatal(err)
+			}
+
+			if id, _ := offsets.Load(context.Background()); id != tt.wantOffset {
+				t.Fatalf("unexpected committed offset: %d", id)
+			}
+
+			if tt.deadLetter && (len(deadLetter) != 1 || deadLetter[0] != "2 failed") {
+				t.Fatalf("unexpected dead letters: %v", deadLetter)
+			}
+		})
+	}
+}
+
+func TestBot_OffsetStore(t *testing.T) {
+	var lastEventID atomic.Value
+
+	offsets := NewMemoryOffsetStore()
+	_ = offsets.Commit(context.Background(), 5)
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if lastEventID.Load() == nil {
+			lastEventID.Store(r.URL.Query().Get("lastEventId"))
+			_, _ = w.Write([]byte(`{"ok": true, "events": [` +
+				`{"eventId": 6, "type": "newMessage", "payload": {"msgId": "1", "chat": {"chatId": "chat1"}}}]}`))
+
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"ok": true, "events": []}`))
+	}, WithOffsetStore(offsets))
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		cancel()
+	})
+
+	if err := bot.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := lastEventID.Load(); v != "5" {
+		t.Fatalf("unexpected lastEventId: %v", v)
+	}
+
+	if id, _ := offsets.Load(context.Background()); id != 6 {
+		t.Fatalf("unexpected committed offset: %d", id)
+	}
+}
@@ -0,0 +1,62 @@
+package icqbotapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option configures the Bot created with NewWithOptions.
+type Option func(b *Bot)
+
+// WithAPIType sets the base URL of the API of ICQ or Mail.Ru Agent.
+func WithAPIType(t apiType) Option {
+	return func(b *Bot) {
+		b.apiBaseURL = icqAPIBaseURL
+		if t == APITypeAgent {
+			b.apiBaseURL = agentAPIBaseURL
+		}
+	}
+}
+
+// WithBaseURL sets the custom base URL of the API, e.g. on-premise installation or local fake server.
+func WithBaseURL(u string) Option {
+	return func(b *Bot) {
+		b.apiBaseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send API requests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(b *Bot) {
+		b.client = c
+	}
+}
+
+// WithUserAgent sets the User-Agent header of API requests.
+func WithUserAgent(ua string) Option {
+	return func(b *Bot) {
+		b.userAgent = ua
+	}
+}
+
+// WithPollTime sets the time the server holds the events request if there are no events.
+func WithPollTime(d time.Duration) Option {
+	return func(b *Bot) {
+		b.pollDuration = d
+	}
+}
+
+// WithRetryPolicy sets the policy of repeating failed API calls.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(b *Bot) {
+		b.retryPolicy = p
+	}
+}
+
+// WithRateLimiter sets the limiter which every outgoing API request passes through.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(b *Bot) {
+		b.limiter = l
+	}
+}
@@ -0,0 +1,58 @@
+package icqbotapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	var userAgent, path string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`{"ok": true, "userId": "bot"}`))
+	}))
+	defer srv.Close()
+
+	bot := NewWithOptions("token",
+		WithBaseURL(srv.URL+"/bot/v1/"),
+		WithHTTPClient(srv.Client()),
+		WithUserAgent("test-bot/1.0"),
+		WithPollTime(30*time.Second),
+	)
+
+	if bot.pollDuration != 30*time.Second {
+		t.Errorf("unexpected poll duration: %v", bot.pollDuration)
+	}
+
+	resp, err := bot.GetSelf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.UserID != "bot" {
+		t.Errorf("unexpected user id: %s", resp.UserID)
+	}
+
+	if path != "/bot/v1/self/get" {
+		t.Errorf("unexpected path: %s", path)
+	}
+
+	if userAgent != "test-bot/1.0" {
+		t.Errorf("unexpected user agent: %s", userAgent)
+	}
+}
+
+func ExampleNewWithOptions() {
+	const token = "001.1104030426.1757333006:757143498"
+	bot := NewWithOptions(token,
+		WithBaseURL("https://myteam.example.com/bot/v1"),
+		WithRetryPolicy(NoRetry),
+		WithRateLimiter(NewTokenBucketLimiter(RateLimit{Rate: 20, Burst: 5}, RateLimit{Rate: 1, Burst: 1})),
+	)
+	_ = bot
+}
@@ -2,11 +2,10 @@ package icqbotapi
 
 import (
 	"context"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
-
-	"github.com/mailru/easyjson"
+	"time"
 
 	"icqbotapi/event"
 )
@@ -16,99 +15,232 @@ type PollResponse struct {
 	Events []event.Event `json:"events"`
 }
 
+// PollEvents polls events and sends them to the returned channel which is closed on shutdown.
+// The event offset is committed once the event is received from the channel, before the caller handles it,
+// so the event is not delivered again if the caller fails or stops before handling it, which is at-most-once delivery.
+// Use HandleEvents for at-least-once delivery of events committed after they are handled.
+// It returns nil if the bot is already running or the offset cannot be loaded.
 func (b *Bot) PollEvents(ctx context.Context) <-chan event.Event {
-	if b.state != botStateStopped {
+	lastEventID, err := b.loadOffset(ctx)
+	if err != nil {
+		b.logger.Log(LogLevelError, "event offset loading failed", LogField{LogKeyError, err})
+		return nil
+	}
+
+	ctx, run, err := b.start(ctx, botStatePolling)
+	if err != nil {
 		return nil
 	}
 
-	b.state = botStatePolling
 	events := make(chan event.Event)
 
-	go b.poll(ctx, events)
+	go func() {
+		b.poll(ctx, lastEventID, events, b.commitOffset)
+		b.finish(run, nil)
+	}()
 
 	return events
 }
 
+// HandleEvents polls events, or receives them from WebhookHandler if the bot is configured WithWebhook,
+// and dispatches them to the handlers in background.
+// Use Stop and Wait or Run to control the shutdown.
 func (b *Bot) HandleEvents(ctx context.Context) {
-	if b.state != botStateStopped {
-		return
+	_, _ = b.handleEvents(ctx)
+}
+
+func (b *Bot) handleEvents(ctx context.Context) (*botRun, error) {
+	lastEventID, err := b.loadOffset(ctx)
+	if err != nil {
+		b.logger.Log(LogLevelError, "event offset loading failed", LogField{LogKeyError, err})
+		return nil, err
+	}
+
+	ctx, run, err := b.start(ctx, botStateHandling)
+	if err != nil {
+		return nil, err
 	}
 
-	b.state = botStateHandling
 	events := make(chan event.Event)
+	b.startDispatcher(ctx, run, events, newOffsetTracker(lastEventID, b.commitOffset, b.holdOffset))
 
-	go b.poll(ctx, events)
 	go func() {
-		for ev := range events {
-			switch ev.Type {
-			case event.KindNewMessage:
-				b.handleNewMessage(ev)
-			case event.KindEditedMessage:
-				b.handleEditMessage(ev)
-			case event.KindDeletedMessage:
-				b.handleDeleteMessage(ev)
-			case event.KindPinnedMessage:
-				b.handlePinMessage(ev)
-			case event.KindUnpinnedMessage:
-				b.handleUnpinMessage(ev)
-			case event.KindNewChatMember:
-				b.handleNewChatMember(ev)
-			case event.KindLeftChatMembers:
-				b.handleLeftChatMember(ev)
-			default:
-				log.Panicf("unexpected event type: %v", ev.Type)
-			}
+		if b.webhookMode {
+			b.webhook.receive(ctx, events)
+		} else {
+			b.poll(ctx, lastEventID, events, nil)
 		}
+
+		b.finish(run, run.drain(b.shutdownTimeout))
 	}()
+
+	return run, nil
 }
 
-func (b *Bot) poll(ctx context.Context, events chan<- event.Event) {
-	lastEventID := 0
+// dispatch passes the event through middlewares to the handler of its kind.
+func (b *Bot) dispatch(ctx context.Context, ev event.Event) error {
+	b.logger.Log(LogLevelDebug, "dispatching event",
+		LogField{LogKeyEventID, ev.EventID},
+		LogField{LogKeyEventKind, ev.Type},
+	)
+
+	ctx = context.WithValue(ctx, contextKeyEvent, ev)
+	ctx = context.WithValue(ctx, contextKeyBot, b)
+
+	return b.chain(ev.Type, b.dispatchKind)(ctx, ev)
+}
+
+// dispatchKind passes the event to the dedicated handler of its kind.
+// Events without the dedicated handler are passed to the handler set with SetEventHandler or the unknown event handler.
+func (b *Bot) dispatchKind(ctx context.Context, ev event.Event) error {
+	if !b.hasKindHandler(ev.Type) {
+		return b.handleCustomEvent(ctx, ev)
+	}
+
+	switch ev.Type {
+	case event.KindNewMessage:
+		return b.handleNewMessage(ctx, ev)
+	case event.KindEditedMessage:
+		return b.handleEditMessage(ctx, ev)
+	case event.KindDeletedMessage:
+		return b.handleDeleteMessage(ctx, ev)
+	case event.KindPinnedMessage:
+		return b.handlePinMessage(ctx, ev)
+	case event.KindUnpinnedMessage:
+		return b.handleUnpinMessage(ctx, ev)
+	case event.KindNewChatMember:
+		return b.handleNewChatMember(ctx, ev)
+	case event.KindLeftChatMembers:
+		return b.handleLeftChatMember(ctx, ev)
+	case event.KindCallbackQuery:
+		return b.handleCallbackQuery(ctx, ev)
+	default:
+		return b.handleCustomEvent(ctx, ev)
+	}
+}
+
+// hasKindHandler reports whether the dedicated handler of the built-in event kind is set.
+func (b *Bot) hasKindHandler(kind event.Kind) bool {
+	h := &b.handlers
+
+	switch kind {
+	case event.KindNewMessage:
+		return h.newMessageHandler != nil
+	case event.KindEditedMessage:
+		return h.editMessageHandler != nil
+	case event.KindDeletedMessage:
+		return h.deleteMessageHandler != nil
+	case event.KindPinnedMessage:
+		return h.pinMessageHandler != nil
+	case event.KindUnpinnedMessage:
+		return h.unpinMessageHandler != nil
+	case event.KindNewChatMember:
+		return h.newChatMemberHandler != nil
+	case event.KindLeftChatMembers:
+		return h.leftChatMembersHandler != nil
+	case event.KindCallbackQuery:
+		return h.callbackQueryHandler != nil
+	}
+
+	return false
+}
+
+// poll requests events after lastEventID and sends them to the channel until the context is done.
+// The delivered function, if not nil, is called with the ID of every event received from the channel.
+func (b *Bot) poll(ctx context.Context, lastEventID int, events chan<- event.Event, delivered func(eventID int)) {
+	defer close(events)
+
+	failures := 0
 
 	for {
 		select {
 		case <-ctx.Done():
-			close(events)
 			return
 		default:
 		}
 
-		req, err := http.NewRequest(http.MethodGet, b.apiBaseURL+"/events/get", nil)
+		evs, err := b.pollOnce(ctx, lastEventID)
 		if err != nil {
-			log.Printf("polling timeout exceeded: %v", err)
-			continue
-		}
+			if ctx.Err() != nil {
+				return
+			}
 
-		q := req.URL.Query()
-		q.Set("lastEventId", strconv.Itoa(lastEventID))
-		q.Set("pollTime", strconv.FormatInt(60, 10))
-		req.URL.RawQuery = q.Encode()
+			b.logger.Log(LogLevelError, "poll request failed", LogField{LogKeyError, err})
+
+			// transient failures are retried silently, others are reported to the error handler.
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) && !isTemporaryError(err) {
+				b.handleError(err)
+			}
+
+			failures++
+			b.pollBackoff(ctx, failures)
 
-		httpResp, err := b.doRequest(ctx, req)
-		if err != nil {
-			log.Printf("poll request error exceeded: %v", err)
 			continue
 		}
 
-		resp := &PollResponse{
-			make([]event.Event, 0),
-		}
+		failures = 0
 
-		err = easyjson.UnmarshalFromReader(httpResp.Body, resp)
-		httpResp.Body.Close()
-		if err != nil {
-			panic(err)
-		}
+		for _, ev := range evs {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+
+			if ev.EventID > lastEventID {
+				lastEventID = ev.EventID
+			}
 
-		maxEventID := 0
-		for _, ev := range resp.Events {
-			if ev.EventID > maxEventID {
-				maxEventID = ev.EventID
+			if delivered != nil {
+				delivered(ev.EventID)
 			}
+		}
+	}
+}
 
-			events <- ev
+// pollOnce requests events after lastEventID. The panic is recovered and returned as *PanicError.
+func (b *Bot) pollOnce(ctx context.Context, lastEventID int) (evs []event.Event, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = newPanicError(v, nil)
 		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, b.apiBaseURL+"/events/get", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Set("lastEventId", strconv.Itoa(lastEventID))
+	q.Set("pollTime", strconv.FormatInt(int64(b.pollDuration/time.Second), 10))
+	req.URL.RawQuery = q.Encode()
+
+	httpResp, err := b.doRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer httpResp.Body.Close()
 
-		lastEventID = maxEventID
+	resp := &PollResponse{
+		make([]event.Event, 0),
 	}
+
+	if err := b.decodeResponse(httpResp, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Events, nil
+}
+
+// pollBackoff waits before the next poll request after consecutive failures.
+func (b *Bot) pollBackoff(ctx context.Context, failures int) {
+	d := b.retryPolicy.backoff(failures)
+	if d <= 0 {
+		d = DefaultRetryPolicy.backoff(failures)
+	}
+
+	_ = sleepContext(ctx, d)
 }
@@ -0,0 +1,201 @@
+package icqbotapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of outgoing API requests.
+type RateLimiter interface {
+	// Wait blocks until the request is allowed or the context is done.
+	// The chatID is empty for requests which are not related to any chat.
+	Wait(ctx context.Context, chatID string) error
+}
+
+// RateLimit represents the budget of the token bucket.
+type RateLimit struct {
+	// Rate is the number of requests per second. Zero rate means no limit.
+	Rate float64
+	// Burst is the maximum number of requests sent at once.
+	Burst int
+}
+
+// RateLimiterStats represents the statistics of the rate limiter.
+type RateLimiterStats struct {
+	// Requests is the number of allowed requests.
+	Requests uint64
+	// Delayed is the number of requests which have waited for the slot.
+	Delayed uint64
+	// TotalDelay is the total queueing delay of all requests.
+	TotalDelay time.Duration
+	// MaxDelay is the maximum queueing delay of a single request.
+	MaxDelay time.Duration
+}
+
+// TokenBucketLimiter is the RateLimiter which maintains the global token bucket
+// and the token bucket for every chat.
+type TokenBucketLimiter struct {
+	perChat RateLimit
+
+	mu          sync.Mutex
+	globalTB    *tokenBucket
+	chatTBs     map[string]*tokenBucket
+	sweepNeeded int
+	stats       RateLimiterStats
+}
+
+// chatBucketsSweepPeriod is the number of created chat buckets after which idle buckets are removed.
+const chatBucketsSweepPeriod = 1024
+
+// NewTokenBucketLimiter creates the rate limiter with the global and per chat budgets.
+func NewTokenBucketLimiter(global, perChat RateLimit) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		perChat:  perChat,
+		globalTB: newTokenBucket(global, time.Now()),
+		chatTBs:  make(map[string]*tokenBucket),
+	}
+}
+
+// Wait blocks until both the global and the chat budgets allow the request or the context is done.
+func (l *TokenBucketLimiter) Wait(ctx context.Context, chatID string) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	chatTB := l.chatBucket(chatID, now)
+
+	delay := l.globalTB.reserve(now)
+	if chatTB != nil {
+		if d := chatTB.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		if err := sleepContext(ctx, delay); err != nil {
+			l.mu.Lock()
+			l.globalTB.cancel()
+			if chatTB != nil {
+				chatTB.cancel()
+			}
+			l.mu.Unlock()
+
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	l.stats.Requests++
+	if delay > 0 {
+		l.stats.Delayed++
+		l.stats.TotalDelay += delay
+		if delay > l.stats.MaxDelay {
+			l.stats.MaxDelay = delay
+		}
+	}
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Stats returns the statistics of the limiter.
+func (l *TokenBucketLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
+
+// chatBucket returns the token bucket of the chat, creating it if needed.
+// It returns nil if the chat is not limited.
+func (l *TokenBucketLimiter) chatBucket(chatID string, now time.Time) *tokenBucket {
+	if chatID == "" || l.perChat.Rate <= 0 {
+		return nil
+	}
+
+	if tb, ok := l.chatTBs[chatID]; ok {
+		return tb
+	}
+
+	l.sweepNeeded++
+	if l.sweepNeeded >= chatBucketsSweepPeriod {
+		l.sweepNeeded = 0
+
+		for id, tb := range l.chatTBs {
+			if tb.isFull(now) {
+				delete(l.chatTBs, id)
+			}
+		}
+	}
+
+	tb := newTokenBucket(l.perChat, now)
+	l.chatTBs[chatID] = tb
+
+	return tb
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l RateLimit, now time.Time) *tokenBucket {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   l.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) isFull(now time.Time) bool {
+	tb.refill(now)
+	return tb.tokens >= tb.burst
+}
+
+// reserve takes the token and returns the delay after which the token becomes available.
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	if tb.rate <= 0 {
+		return 0
+	}
+
+	tb.refill(now)
+	tb.tokens--
+
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// cancel returns the reserved token.
+func (tb *tokenBucket) cancel() {
+	if tb.rate > 0 {
+		tb.tokens++
+	}
+}
+
+// SetRateLimiter sets the limiter which every outgoing API request passes through.
+func (b *Bot) SetRateLimiter(l RateLimiter) {
+	b.limiter = l
+}
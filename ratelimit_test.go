@@ -0,0 +1,68 @@
+package icqbotapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter_Wait(t *testing.T) {
+	l := NewTokenBucketLimiter(RateLimit{}, RateLimit{Rate: 20, Burst: 1})
+	ctx := context.Background()
+
+	start := time.Now()
+	for _, chatID := range []string{"chat1", "chat2", "chat3"} {
+		if err := l.Wait(ctx, chatID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := time.Since(start); d > 40*time.Millisecond {
+		t.Fatalf("different chats are throttled: %v", d)
+	}
+
+	if err := l.Wait(ctx, "chat1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := l.Stats()
+	if stats.Requests != 4 || stats.Delayed != 1 || stats.MaxDelay <= 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestTokenBucketLimiter_WaitCanceled(t *testing.T) {
+	l := NewTokenBucketLimiter(RateLimit{Rate: 0.1, Burst: 1}, RateLimit{})
+
+	if err := l.Wait(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, ""); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBot_SetRateLimiter(t *testing.T) {
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	})
+	defer done()
+
+	l := NewTokenBucketLimiter(RateLimit{Rate: 100, Burst: 1}, RateLimit{})
+	bot.SetRateLimiter(l)
+
+	for i := 0; i < 3; i++ {
+		if _, err := bot.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := l.Stats(); stats.Requests != 3 || stats.Delayed != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
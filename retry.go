@@ -0,0 +1,293 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultSafeMethods lists API methods which can be repeated without side effects.
+var DefaultSafeMethods = []string{
+	"/self/get",
+	"/chats/getInfo",
+	"/chats/getAdmins",
+	"/chats/sendActions",
+	"/files/getInfo",
+	downloadMethod,
+	"/messages/editText",
+	"/messages/deleteMessages",
+	"/events/get",
+}
+
+// DefaultRetryPolicy is the retry policy of bots created with New.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.2,
+}
+
+// NoRetry is the retry policy which disables retries.
+var NoRetry = RetryPolicy{
+	MaxAttempts: 1,
+}
+
+// RetryPolicy configures repeating of failed API calls.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It is doubled for every next retry.
+	BaseDelay time.Duration
+	// MaxDelay limits the delay between attempts. The call is not repeated
+	// if the server asks with Retry-After header to wait longer.
+	MaxDelay time.Duration
+	// Jitter is the randomized fraction of the delay, from 0 to 1.
+	Jitter float64
+	// SafeMethods lists API methods which can be repeated after any transient failure.
+	// Other methods, e.g. "/messages/sendText", are repeated only when the server
+	// has certainly not processed the request, so that messages are not duplicated.
+	// DefaultSafeMethods is used if nil.
+	SafeMethods []string
+}
+
+func (p *RetryPolicy) isSafe(method string) bool {
+	methods := p.SafeMethods
+	if methods == nil {
+		methods = DefaultSafeMethods
+	}
+
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the delay before the n-th retry.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	const maxDoublings = 32
+
+	d := p.BaseDelay
+	for i := 1; i < n && i < maxDoublings && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d)) //nolint:gosec
+	}
+
+	return d
+}
+
+// retryDelay reports whether the failed attempt should be repeated and the delay before the retry.
+func (p *RetryPolicy) retryDelay(method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	safe := p.isSafe(method)
+
+	switch {
+	case err != nil:
+		if !isTemporaryError(err) || (!safe && !isDialError(err)) {
+			return 0, false
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, p.allowsDelay(d)
+		}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		// the server responding with 503 has not processed the request.
+		if !safe && resp.StatusCode != http.StatusServiceUnavailable {
+			return 0, false
+		}
+
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, p.allowsDelay(d)
+		}
+	default:
+		return 0, false
+	}
+
+	return p.backoff(attempt), true
+}
+
+// allowsDelay reports whether the delay requested by the server does not exceed MaxDelay.
+func (p *RetryPolicy) allowsDelay(d time.Duration) bool {
+	return p.MaxDelay <= 0 || d <= p.MaxDelay
+}
+
+func isTemporaryError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// only errors of sending the request are temporary.
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+
+	var netErr net.Error
+
+	return errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF) || errors.Is(urlErr.Err, io.EOF)
+}
+
+// isDialError reports whether the connection to the server has not been established,
+// so the request has certainly not been sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter parses the value of Retry-After header, either in seconds or as HTTP date.
+func parseRetryAfter(h string) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(h); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return 0, false
+}
+
+// SetRetryPolicy sets the policy of repeating failed API calls.
+func (b *Bot) SetRetryPolicy(p RetryPolicy) {
+	b.retryPolicy = p
+}
+
+// doRequestWithRetry sends the request repeating it according to the retry policy.
+func (b *Bot) doRequestWithRetry(ctx context.Context, r *http.Request) (*http.Response, error) {
+	return b.doMethodRequestWithRetry(ctx, b.apiMethod(r), r)
+}
+
+// doMethodRequestWithRetry sends the request of the method repeating it according to the retry policy.
+func (b *Bot) doMethodRequestWithRetry(ctx context.Context, method string, r *http.Request) (*http.Response, error) {
+	chatID := r.URL.Query().Get("chatId")
+	p := b.retryPolicy
+
+	// the request with body which cannot be rewound is sent once.
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		p = NoRetry
+	}
+
+	for attempt := 1; ; attempt++ {
+		req := r.Clone(ctx)
+		if attempt > 1 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req.Body = body
+		}
+
+		if b.limiter != nil {
+			if err := b.limiter.Wait(ctx, chatID); err != nil {
+				return nil, err
+			}
+		}
+
+		start := time.Now()
+		resp, err := b.client.Do(req)
+		err = redactToken(err)
+		b.logRequest(method, chatID, attempt, time.Since(start), resp, err)
+
+		delay, retry := p.retryDelay(method, attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// redactToken hides the API token in the URL of the request error, since the error is logged and returned to callers.
+func redactToken(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return &url.Error{Op: urlErr.Op, URL: "", Err: urlErr.Err}
+	}
+
+	q := u.Query()
+	if q.Get(tokenQueryParam) == "" {
+		return err
+	}
+
+	q.Set(tokenQueryParam, "REDACTED")
+	u.RawQuery = q.Encode()
+
+	return &url.Error{Op: urlErr.Op, URL: u.String(), Err: urlErr.Err}
+}
+
+func (b *Bot) logRequest(method, chatID string, attempt int, latency time.Duration, resp *http.Response, err error) {
+	fields := []LogField{
+		{LogKeyMethod, method},
+		{LogKeyChatID, chatID},
+		{LogKeyAttempt, attempt},
+		{LogKeyLatency, latency},
+	}
+
+	if err != nil {
+		b.logger.Log(LogLevelWarn, "api request failed", append(fields, LogField{LogKeyError, err})...)
+		return
+	}
+
+	fields = append(fields, LogField{LogKeyStatus, resp.StatusCode})
+	if resp.StatusCode >= http.StatusBadRequest {
+		b.logger.Log(LogLevelWarn, "api request failed", fields...)
+		return
+	}
+
+	b.logger.Log(LogLevelDebug, "api request", fields...)
+}
+
+// sleepContext pauses the current goroutine for the duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package icqbotapi
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    10 * time.Millisecond,
+}
+
+func TestBot_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		retryAfter   string
+		do           func(b *Bot) error
+		wantAttempts int32
+	}{
+		{
+			name:       "safe method",
+			statusCode: http.StatusBadGateway,
+			do: func(b *Bot) error {
+				_, err := b.GetChatInfo(context.Background(), "chat1")
+				return err
+			},
+			wantAttempts: 3,
+		},
+		{
+			name:       "unsafe method",
+			statusCode: http.StatusBadGateway,
+			do: func(b *Bot) error {
+				_, err := b.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"})
+				return err
+			},
+			wantAttempts: 1,
+		},
+		{
+			name:       "unsafe method rate limited",
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "0",
+			do: func(b *Bot) error {
+				_, err := b.SendText(context.Background(), &SendTextRequest{ChatID: "chat1", Text: "text"})
+				return err
+			},
+			wantAttempts: 3,
+		},
+		{
+			name:       "retry after exceeds max delay",
+			statusCode: http.StatusServiceUnavailable,
+			retryAfter: "3600",
+			do: func(b *Bot) error {
+				_, err := b.GetChatInfo(context.Background(), "chat1")
+				return err
+			},
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+
+			bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+
+				w.WriteHeader(tt.statusCode)
+			})
+			defer done()
+
+			bot.SetRetryPolicy(testRetryPolicy)
+
+			if err := tt.do(bot); !IsRetryable(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Fatalf("unexpected attempts: %d", attempts)
+			}
+		})
+	}
+}
+
+func TestBot_RetrySucceeds(t *testing.T) {
+	var attempts int32
+
+	bot, done := newTestBot(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok": true, "title": "chat"}`))
+	})
+	defer done()
+
+	bot.SetRetryPolicy(testRetryPolicy)
+
+	resp, err := bot.GetChatInfo(context.Background(), "chat1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Title != "chat" {
+		t.Fatalf("unexpected title: %s", resp.Title)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := p.backoff(n + 1); d != want {
+			t.Errorf("unexpected delay of retry %d: %v", n+1, d)
+		}
+	}
+}
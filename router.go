@@ -0,0 +1,416 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"icqbotapi/event"
+)
+
+var (
+	// ErrInvalidArgument is returned when command arguments cannot be bound to the values.
+	ErrInvalidArgument = errors.New("invalid command argument")
+	// ErrUnclosedQuote is returned when the quoted command argument is not closed.
+	ErrUnclosedQuote = errors.New("unclosed quote in command arguments")
+)
+
+// ArgumentError represents the command argument which cannot be bound to the value.
+type ArgumentError struct {
+	// Index is the zero-based position of the argument.
+	Index int
+	Value string
+	Err   error
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("argument %d %q: %v", e.Index+1, e.Value, e.Err)
+}
+
+// Is makes errors.Is(err, ErrInvalidArgument) match.
+func (e *ArgumentError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+func (e *ArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// Command represents the command parsed from the new message, e.g. /remind 10m "call mom".
+type Command struct {
+	// Name is the lowercased name of the command without the slash and the bot mention.
+	Name string
+	// Alias is the lowercased name the command has been invoked with, which is either Name or one of its aliases.
+	Alias string
+	// Args are the arguments split by whitespace, quoted arguments are unquoted.
+	Args []string
+	// RawArgs is the text following the command name as is.
+	RawArgs string
+	Message event.NewMessagePayload
+}
+
+// Bind binds arguments to the values pointed by dst in order.
+// Supported pointers are *string, *int, *int64, *uint64, *float64, *bool and *time.Duration.
+// The last pointer can be *[]string, which receives all the remaining arguments.
+// It returns *ArgumentError if the argument is missing, extra or cannot be parsed.
+func (c *Command) Bind(dst ...interface{}) error {
+	for i, d := range dst {
+		if rest, ok := d.(*[]string); ok && i == len(dst)-1 {
+			if i < len(c.Args) {
+				*rest = append([]string(nil), c.Args[i:]...)
+			} else {
+				*rest = nil
+			}
+
+			return nil
+		}
+
+		if i >= len(c.Args) {
+			return &ArgumentError{Index: i, Err: errors.New("is missing")}
+		}
+
+		if err := bindArgument(c.Args[i], d); err != nil {
+			return &ArgumentError{Index: i, Value: c.Args[i], Err: err}
+		}
+	}
+
+	if len(c.Args) > len(dst) {
+		return &ArgumentError{Index: len(dst), Value: c.Args[len(dst)], Err: errors.New("is unexpected")}
+	}
+
+	return nil
+}
+
+func bindArgument(s string, dst interface{}) error {
+	var err error
+
+	switch d := dst.(type) {
+	case *string:
+		*d = s
+	case *int:
+		*d, err = strconv.Atoi(s)
+	case *int64:
+		*d, err = strconv.ParseInt(s, 10, 64)
+	case *uint64:
+		*d, err = strconv.ParseUint(s, 10, 64)
+	case *float64:
+		*d, err = strconv.ParseFloat(s, 64)
+	case *bool:
+		*d, err = strconv.ParseBool(s)
+	case *time.Duration:
+		*d, err = time.ParseDuration(s)
+	default:
+		return fmt.Errorf("unsupported destination %T", dst)
+	}
+
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err
+	}
+
+	return err
+}
+
+// CommandHandlerFunc handles the command routed by Router.
+// It receives the context and the bot handling the message, so it can reply to the command.
+type CommandHandlerFunc func(ctx context.Context, b *Bot, cmd *Command) error
+
+// CommandOption configures the command registered in Router.
+type CommandOption func(r *route)
+
+// CommandAliases sets alternative names of the command.
+func CommandAliases(aliases ...string) CommandOption {
+	return func(r *route) {
+		r.aliases = append(r.aliases, aliases...)
+	}
+}
+
+// CommandDescription sets the description of the command shown in the help text.
+func CommandDescription(description string) CommandOption {
+	return func(r *route) {
+		r.description = description
+	}
+}
+
+// CommandUsage sets the arguments of the command shown in the help text, e.g. "<duration> <text>".
+func CommandUsage(usage string) CommandOption {
+	return func(r *route) {
+		r.usage = usage
+	}
+}
+
+type route struct {
+	name        string
+	aliases     []string
+	description string
+	usage       string
+	handler     CommandHandlerFunc
+}
+
+// Router routes new messages starting with the slash to the handlers of commands.
+// Messages which are not commands or whose command is not registered are passed to the fallback handler.
+// Commands must be registered before the bot starts handling events.
+type Router struct {
+	botNick         string
+	routes          map[string]*route
+	names           []string
+	fallbackHandler newMessageHandlerFunc
+	errorHandler    func(cmd *Command, err error)
+}
+
+// NewRouter creates the router without commands.
+func NewRouter() *Router {
+	return &Router{
+		routes: make(map[string]*route),
+	}
+}
+
+// SetBotNick sets the nick of the bot, so commands mentioning other bots, e.g. /start@otherbot, are not routed.
+// Any mention is stripped from the command if the nick is not set.
+func (r *Router) SetBotNick(nick string) {
+	r.botNick = strings.ToLower(strings.TrimPrefix(nick, "@"))
+}
+
+// Handle registers the handler of the command named without the slash.
+// Names are case-insensitive, registering the same name again replaces the handler and its aliases.
+// The name or the alias takes over the alias of another command registered before,
+// while the alias colliding with the name of another command panics.
+func (r *Router) Handle(name string, fn CommandHandlerFunc, opts ...CommandOption) {
+	rt := &route{
+		name:    normalizeCommandName(name),
+		handler: fn,
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	aliases := make([]string, 0, len(rt.aliases))
+	seen := map[string]bool{rt.name: true}
+
+	for _, alias := range rt.aliases {
+		alias = normalizeCommandName(alias)
+		if seen[alias] {
+			continue
+		}
+
+		if other, ok := r.routes[alias]; ok && other.name == alias && alias != rt.name {
+			panic("icqbotapi: alias /" + alias + " collides with the command /" + alias)
+		}
+
+		seen[alias] = true
+		aliases = append(aliases, alias)
+	}
+
+	rt.aliases = aliases
+
+	if old, ok := r.routes[rt.name]; ok && old.name == rt.name {
+		// aliases of the replaced command are not routed to its stale handler.
+		for _, alias := range old.aliases {
+			delete(r.routes, alias)
+		}
+	} else {
+		if ok {
+			old.removeAlias(rt.name)
+		}
+
+		r.names = append(r.names, rt.name)
+	}
+
+	r.routes[rt.name] = rt
+
+	for _, alias := range rt.aliases {
+		if other, ok := r.routes[alias]; ok {
+			// the alias of another command is taken over by the later one.
+			other.removeAlias(alias)
+		}
+
+		r.routes[alias] = rt
+	}
+}
+
+func normalizeCommandName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "/"))
+}
+
+func (rt *route) removeAlias(alias string) {
+	for i, a := range rt.aliases {
+		if a == alias {
+			rt.aliases = append(rt.aliases[:i:i], rt.aliases[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetFallbackHandler sets the handler of messages which are not registered commands.
+func (r *Router) SetFallbackHandler(fn newMessageHandlerFunc) {
+	r.fallbackHandler = fn
+}
+
+// SetErrorHandler sets the handler of errors returned by command handlers or occurred during parsing arguments.
+// If it is not set, errors are reported to the error handler of the bot set with SetRouter.
+func (r *Router) SetErrorHandler(fn func(cmd *Command, err error)) {
+	r.errorHandler = fn
+}
+
+// Help returns the help text listing registered commands in alphabetical order.
+func (r *Router) Help() string {
+	names := append([]string(nil), r.names...)
+	sort.Strings(names)
+
+	sb := strings.Builder{}
+
+	for _, name := range names {
+		rt := r.routes[name]
+
+		sb.WriteString("/" + rt.name)
+
+		if rt.usage != "" {
+			sb.WriteString(" " + rt.usage)
+		}
+
+		if rt.description != "" {
+			sb.WriteString(" - " + rt.description)
+		}
+
+		if len(rt.aliases) > 0 {
+			sb.WriteString(" (/" + strings.Join(rt.aliases, ", /") + ")")
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// HandleMessage routes the new message handled by the bot. Errors are dropped if the router has no error handler,
+// use SetRouter to report them to the error handler of the bot.
+func (r *Router) HandleMessage(ctx context.Context, b *Bot, e event.NewMessagePayload) {
+	_ = r.handleMessage(ctx, b, e)
+}
+
+// handleMessage routes the new message. It returns the error of the command if the router has no error handler.
+func (r *Router) handleMessage(ctx context.Context, b *Bot, e event.NewMessagePayload) error {
+	cmd, rt := r.match(e)
+	if rt == nil {
+		if r.fallbackHandler != nil {
+			r.fallbackHandler(e)
+		}
+
+		return nil
+	}
+
+	args, err := splitArgs(cmd.RawArgs)
+	if err == nil {
+		cmd.Args = args
+		err = rt.handler(ctx, b, cmd)
+	}
+
+	if err != nil && r.errorHandler != nil {
+		r.errorHandler(cmd, err)
+		return nil
+	}
+
+	return err
+}
+
+// match parses the command of the message and finds its route.
+func (r *Router) match(e event.NewMessagePayload) (*Command, *route) {
+	text := strings.TrimLeftFunc(e.Text, unicode.IsSpace)
+	if !strings.HasPrefix(text, "/") {
+		return nil, nil
+	}
+
+	name := text[1:]
+	rawArgs := ""
+
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, rawArgs = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	name = strings.ToLower(name)
+
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		if r.botNick != "" && name[i+1:] != r.botNick {
+			return nil, nil
+		}
+
+		name = name[:i]
+	}
+
+	rt, ok := r.routes[name]
+	if !ok {
+		return nil, nil
+	}
+
+	return &Command{
+		Name:    rt.name,
+		Alias:   name,
+		RawArgs: rawArgs,
+		Message: e,
+	}, rt
+}
+
+// splitArgs splits arguments by whitespace. Arguments can be quoted with " or ',
+// the backslash escapes the following character.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			inArg = true
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			inArg = true
+			quote = c
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			current.WriteRune(c)
+		}
+	}
+
+	if quote != 0 {
+		return nil, ErrUnclosedQuote
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// SetRouter sets the router as the handler to events about new message.
+// Errors of commands are reported to the error handler of the bot unless the router has its own one.
+func (b *Bot) SetRouter(r *Router) {
+	b.SetNewMessageContextHandler(func(ctx context.Context, b *Bot, e event.NewMessagePayload) error {
+		return r.handleMessage(ctx, b, e)
+	})
+}
@@ -0,0 +1,245 @@
+package icqbotapi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+)
+
+func TestRouter_HandleMessage(t *testing.T) {
+	var (
+		got      *Command
+		fallback []string
+	)
+
+	r := NewRouter()
+	r.SetBotNick("@TestBot")
+	r.Handle("remind", func(_ context.Context, _ *Bot, cmd *Command) error {
+		got = cmd
+		return nil
+	}, CommandAliases("r"))
+	r.SetFallbackHandler(func(e event.NewMessagePayload) {
+		fallback = append(fallback, e.Text)
+	})
+
+	tests := []struct {
+		name     string
+		text     string
+		wantCmd  *Command
+		fallback bool
+	}{
+		{
+			name: "command",
+			text: `/remind 10m "call mom" it\'s   time`,
+			wantCmd: &Command{
+				Name:    "remind",
+				Alias:   "remind",
+				Args:    []string{"10m", "call mom", "it's", "time"},
+				RawArgs: `10m "call mom" it\'s   time`,
+			},
+		},
+		{
+			name: "alias with mention",
+			text: "/R@testbot 'a b'",
+			wantCmd: &Command{
+				Name:    "remind",
+				Alias:   "r",
+				Args:    []string{"a b"},
+				RawArgs: "'a b'",
+			},
+		},
+		{
+			name:     "other bot",
+			text:     "/remind@otherbot 1m",
+			fallback: true,
+		},
+		{
+			name:     "unknown command",
+			text:     "/start",
+			fallback: true,
+		},
+		{
+			name:     "plain text",
+			text:     "hello",
+			fallback: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, fallback = nil, nil
+			r.HandleMessage(context.Background(), nil, event.NewMessagePayload{Text: tt.text})
+
+			if tt.fallback {
+				if got != nil || !reflect.DeepEqual(fallback, []string{tt.text}) {
+					t.Fatalf("message is not passed to fallback: %+v", got)
+				}
+
+				return
+			}
+
+			if got == nil {
+				t.Fatal("command is not routed")
+			}
+
+			got.Message = event.NewMessagePayload{}
+			if !reflect.DeepEqual(got, tt.wantCmd) {
+				t.Fatalf("unexpected command: %+v", got)
+			}
+		})
+	}
+}
+
+func TestRouter_errors(t *testing.T) {
+	var errs []error
+
+	r := NewRouter()
+	r.Handle("sleep", func(_ context.Context, _ *Bot, cmd *Command) error {
+		var d time.Duration
+		return cmd.Bind(&d)
+	})
+	r.SetErrorHandler(func(cmd *Command, err error) {
+		errs = append(errs, err)
+	})
+
+	r.HandleMessage(context.Background(), nil, event.NewMessagePayload{Text: `/sleep "10s`})
+	r.HandleMessage(context.Background(), nil, event.NewMessagePayload{Text: "/sleep soon"})
+
+	if len(errs) != 2 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if !errors.Is(errs[0], ErrUnclosedQuote) {
+		t.Fatalf("unexpected error: %v", errs[0])
+	}
+
+	if !errors.Is(errs[1], ErrInvalidArgument) {
+		t.Fatalf("unexpected error: %v", errs[1])
+	}
+}
+
+func TestCommand_Bind(t *testing.T) {
+	cmd := &Command{Args: []string{"-5", "42", "1.5", "true", "1h", "a", "b"}}
+
+	var (
+		i    int
+		u    uint64
+		f    float64
+		ok   bool
+		d    time.Duration
+		rest []string
+	)
+
+	if err := cmd.Bind(&i, &u, &f, &ok, &d, &rest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if i != -5 || u != 42 || f != 1.5 || !ok || d != time.Hour || !reflect.DeepEqual(rest, []string{"a", "b"}) {
+		t.Fatalf("unexpected values: %v %v %v %v %v %v", i, u, f, ok, d, rest)
+	}
+
+	var argErr *ArgumentError
+
+	if err := cmd.Bind(&i); !errors.As(err, &argErr) || argErr.Index != 1 {
+		t.Fatalf("extra argument is not reported: %v", err)
+	}
+
+	if err := cmd.Bind(&i, &u, &f, &ok, &d, &i, &i, &i); !errors.As(err, &argErr) || argErr.Index != 5 {
+		t.Fatalf("invalid argument is not reported: %v", err)
+	}
+
+	if err := (&Command{}).Bind(&i); !errors.As(err, &argErr) || argErr.Index != 0 {
+		t.Fatalf("missing argument is not reported: %v", err)
+	}
+}
+
+func TestRouter_Help(t *testing.T) {
+	r := NewRouter()
+	r.Handle("start", func(context.Context, *Bot, *Command) error { return nil }, CommandDescription("starts the bot"))
+	r.Handle("remind", func(context.Context, *Bot, *Command) error { return nil },
+		CommandUsage("<duration> <text>"), CommandDescription("reminds later"), CommandAliases("r"))
+
+	want := "/remind <duration> <text> - reminds later (/r)\n/start - starts the bot\n"
+	if got := r.Help(); got != want {
+		t.Fatalf("unexpected help: %q", got)
+	}
+}
+
+func TestRouter_aliases(t *testing.T) {
+	var routed []string
+
+	handler := func(name string) CommandHandlerFunc {
+		return func(_ context.Context, _ *Bot, cmd *Command) error {
+			routed = append(routed, name+" "+cmd.Alias)
+			return nil
+		}
+	}
+
+	r := NewRouter()
+	r.SetFallbackHandler(func(e event.NewMessagePayload) {
+		routed = append(routed, "fallback "+e.Text)
+	})
+	r.Handle("remind", handler("old"), CommandAliases("r", "later"))
+	// the command registered again drops its old aliases.
+	r.Handle("remind", handler("new"), CommandAliases("R"))
+	// the alias of the command registered later takes over.
+	r.Handle("report", handler("report"), CommandAliases("r"))
+
+	for _, text := range []string{"/remind", "/later", "/r"} {
+		r.HandleMessage(context.Background(), nil, event.NewMessagePayload{Text: text})
+	}
+
+	want := []string{"new remind", "fallback /later", "report r"}
+	if !reflect.DeepEqual(routed, want) {
+		t.Fatalf("unexpected routes: %v", routed)
+	}
+
+	if help := r.Help(); help != "/remind\n/report (/r)\n" {
+		t.Fatalf("unexpected help: %q", help)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("alias colliding with the command does not panic")
+		}
+	}()
+
+	r.Handle("start", handler("start"), CommandAliases("remind"))
+}
+
+func TestBot_SetRouterErrors(t *testing.T) {
+	var errs []error
+
+	bot := NewWithOptions("token", WithLogger(NopLogger))
+	bot.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+
+	var handledBy *Bot
+
+	r := NewRouter()
+	r.Handle("fail", func(_ context.Context, b *Bot, cmd *Command) error {
+		handledBy = b
+		return errors.New("failed")
+	})
+	bot.SetRouter(r)
+
+	ev := event.Event{
+		EventID: 1,
+		Type:    event.KindNewMessage,
+		Payload: []byte(`{"msgId": "1", "chat": {"chatId": "chat1"}, "text": "/fail"}`),
+	}
+
+	if err := bot.safeDispatch(context.Background(), ev); err == nil || len(errs) != 1 || errs[0].Error() != "failed" {
+		t.Fatalf("command error is not reported to the bot: %v, %v", err, errs)
+	}
+
+	if handledBy != bot {
+		t.Fatal("command handler does not receive the bot")
+	}
+}
@@ -0,0 +1,239 @@
+package icqbotapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailru/easyjson"
+)
+
+// SessionKey identifies the conversation of the user in the chat.
+type SessionKey struct {
+	ChatID string
+	UserID string
+}
+
+func (k SessionKey) String() string {
+	return k.ChatID + ":" + k.UserID
+}
+
+//easyjson:json
+// Session represents the state of the conversation and the data collected during it.
+type Session struct {
+	State     string            `json:"state"`
+	Data      map[string]string `json:"data"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// SessionStore persists sessions of conversations.
+type SessionStore interface {
+	// Load returns the session of the key or nil if there is none.
+	Load(ctx context.Context, key SessionKey) (*Session, error)
+	// Save saves the session of the key.
+	Save(ctx context.Context, key SessionKey, s *Session) error
+	// Delete deletes the session of the key. It does nothing if there is none.
+	Delete(ctx context.Context, key SessionKey) error
+}
+
+// SessionExpirer is implemented by session stores which can delete expired sessions in bulk.
+// Conversation with the timeout calls it periodically, so sessions of users who never come back are removed.
+type SessionExpirer interface {
+	// DeleteExpired deletes sessions updated before the time.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// MemorySessionStore is the SessionStore which keeps sessions in memory.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[SessionKey]Session
+}
+
+// NewMemorySessionStore creates the in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[SessionKey]Session),
+	}
+}
+
+// Load returns the copy of the session of the key.
+func (s *MemorySessionStore) Load(_ context.Context, key SessionKey) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[key]
+	if !ok {
+		return nil, nil
+	}
+
+	sess.Data = copySessionData(sess.Data)
+
+	return &sess, nil
+}
+
+// Save saves the copy of the session of the key.
+func (s *MemorySessionStore) Save(_ context.Context, key SessionKey, sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *sess
+	c.Data = copySessionData(sess.Data)
+	s.sessions[key] = c
+
+	return nil
+}
+
+// Delete deletes the session of the key.
+func (s *MemorySessionStore) Delete(_ context.Context, key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, key)
+
+	return nil
+}
+
+// DeleteExpired deletes sessions updated before the time.
+func (s *MemorySessionStore) DeleteExpired(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, sess := range s.sessions {
+		if sess.UpdatedAt.Before(before) {
+			delete(s.sessions, key)
+		}
+	}
+
+	return nil
+}
+
+func copySessionData(data map[string]string) map[string]string {
+	c := make(map[string]string, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+
+	return c
+}
+
+// FileSessionStore is the SessionStore which keeps every session in the JSON file in the directory.
+type FileSessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileSessionStore creates the session store which keeps sessions in the directory.
+// The directory must exist.
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{
+		dir: dir,
+	}
+}
+
+// path returns the path of the file of the session. The parts of the key are escaped separately,
+// so the underscore separating them never appears in the chat ID and different keys never share the file.
+func (s *FileSessionStore) path(key SessionKey) string {
+	return filepath.Join(s.dir, escapeSessionKeyPart(key.ChatID)+"_"+escapeSessionKeyPart(key.UserID)+".json")
+}
+
+// sessionKeyReplacer escapes the separator and the colon, which is not allowed in file names on Windows.
+var sessionKeyReplacer = strings.NewReplacer("_", "%5F", ":", "%3A")
+
+func escapeSessionKeyPart(s string) string {
+	return sessionKeyReplacer.Replace(url.PathEscape(s))
+}
+
+// Load reads the session of the key from the file. It returns nil if the file does not exist.
+func (s *FileSessionStore) Load(_ context.Context, key SessionKey) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &Session{}
+	if err := easyjson.Unmarshal(p, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Save writes the session of the key to the file.
+// The file is replaced atomically, so it is never left partially written.
+func (s *FileSessionStore) Save(_ context.Context, key SessionKey, sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := easyjson.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path(key), p)
+}
+
+// Delete removes the file of the session of the key.
+func (s *FileSessionStore) Delete(_ context.Context, key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired removes files of sessions updated before the time.
+func (s *FileSessionStore) DeleteExpired(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(s.dir, f.Name())
+
+		p, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		sess := &Session{}
+		if err := easyjson.Unmarshal(p, sess); err != nil {
+			// files of other applications in the directory are left intact.
+			continue
+		}
+
+		if sess.UpdatedAt.Before(before) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
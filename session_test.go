@@ -0,0 +1,105 @@
+package icqbotapi
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSessionStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	stores := map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   NewFileSessionStore(dir),
+	}
+
+	for name, s := range stores {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := SessionKey{ChatID: "chat/1@chat.agent", UserID: "user1"}
+
+			if sess, err := s.Load(ctx, key); err != nil || sess != nil {
+				t.Fatalf("unexpected session: %v, %v", sess, err)
+			}
+
+			want := &Session{
+				State:     "severity",
+				Data:      map[string]string{"title": "outage"},
+				UpdatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			}
+
+			if err := s.Save(ctx, key, want); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Load(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.State != want.State || !reflect.DeepEqual(got.Data, want.Data) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+				t.Fatalf("unexpected session: %+v", got)
+			}
+
+			if err := s.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Delete(ctx, key); err != nil {
+				t.Fatalf("deleting missing session failed: %v", err)
+			}
+
+			if sess, err := s.Load(ctx, key); err != nil || sess != nil {
+				t.Fatalf("session is not deleted: %v, %v", sess, err)
+			}
+
+			// keys with the separator in their parts do not share the session.
+			first, second := SessionKey{ChatID: "a_b:1", UserID: "c"}, SessionKey{ChatID: "a", UserID: "b:1_c"}
+			old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			if err := s.Save(ctx, first, &Session{State: "first", UpdatedAt: old}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Save(ctx, second, &Session{State: "second", UpdatedAt: old.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if sess, err := s.Load(ctx, first); err != nil || sess.State != "first" {
+				t.Fatalf("unexpected session: %+v, %v", sess, err)
+			}
+
+			if err := s.(SessionExpirer).DeleteExpired(ctx, old.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+
+			if sess, err := s.Load(ctx, first); err != nil || sess != nil {
+				t.Fatalf("expired session is not deleted: %+v, %v", sess, err)
+			}
+
+			if sess, err := s.Load(ctx, second); err != nil || sess == nil {
+				t.Fatalf("session is deleted before it expires: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileSessionStore_path(t *testing.T) {
+	s := NewFileSessionStore("sessions")
+
+	name := filepath.Base(s.path(SessionKey{ChatID: "chat_1:2@chat.agent", UserID: "user/1"}))
+	if name != "chat%5F1%3A2@chat.agent_user%2F1.json" {
+		t.Fatalf("unexpected file name: %s", name)
+	}
+}
@@ -0,0 +1,202 @@
+package icqbotapi
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+)
+
+// ErrFileTooLarge is returned when the uploaded or downloaded file exceeds the size
+// set WithMaxUploadSize or WithMaxDownloadSize.
+var ErrFileTooLarge = errors.New("file exceeds the maximum size")
+
+// WithMaxUploadSize sets the maximum size of the file uploaded with SendNewFile.
+// The size of seekable files is checked before the upload, other files are checked while streaming.
+// Zero size means no limit.
+func WithMaxUploadSize(n int64) Option {
+	return func(b *Bot) {
+		if n >= 0 {
+			b.maxUploadSize = n
+		}
+	}
+}
+
+// multipartUpload streams the file as the multipart form through the pipe, so the file is never buffered in memory.
+// The upload of the seekable file can be reopened to repeat the request.
+type multipartUpload struct {
+	file     io.Reader
+	filename string
+	boundary string
+	// start is the offset of the seekable file the upload starts from.
+	start    int64
+	seekable bool
+	// size is the size of the file or -1 if it is unknown.
+	size     int64
+	maxSize  int64
+	progress func(sent, total int64)
+
+	pr   *io.PipeReader
+	done chan struct{}
+	err  error
+}
+
+func newMultipartUpload(file io.Reader, filename string, maxSize int64, progress func(sent, total int64)) (*multipartUpload, error) {
+	u := &multipartUpload{
+		file:     file,
+		filename: filename,
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+		size:     -1,
+		maxSize:  maxSize,
+		progress: progress,
+	}
+
+	if s, ok := file.(io.Seeker); ok {
+		start, err := s.Seek(0, io.SeekCurrent)
+		if err == nil {
+			end, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := s.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+
+			u.start, u.seekable, u.size = start, true, end-start
+		}
+	}
+
+	if u.maxSize > 0 && u.size > u.maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	return u, nil
+}
+
+// contentLength returns the length of the multipart body or -1 if it is unknown.
+func (u *multipartUpload) contentLength() int64 {
+	if u.size < 0 {
+		return -1
+	}
+
+	cw := &countingWriter{}
+	mw := u.writer(cw)
+
+	// writing to countingWriter never fails.
+	_, _ = mw.CreateFormFile("file", u.filename)
+	_ = mw.Close()
+
+	return cw.n + u.size
+}
+
+func (u *multipartUpload) contentType() string {
+	return u.writer(ioutil.Discard).FormDataContentType()
+}
+
+func (u *multipartUpload) writer(w io.Writer) *multipart.Writer {
+	mw := multipart.NewWriter(w)
+	// the boundary is generated by multipart.Writer, so it is always valid.
+	_ = mw.SetBoundary(u.boundary)
+
+	return mw
+}
+
+// open starts streaming the multipart body. The previous body is closed and the seekable file is rewound.
+func (u *multipartUpload) open() (io.ReadCloser, error) {
+	if u.pr != nil {
+		u.close()
+
+		if !u.seekable {
+			return nil, errors.New("upload of not seekable file cannot be repeated")
+		}
+
+		if _, err := u.file.(io.Seeker).Seek(u.start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	u.pr, u.done, u.err = pr, make(chan struct{}), nil
+
+	go func(done chan<- struct{}) {
+		defer close(done)
+
+		u.err = u.write(pw)
+		pw.CloseWithError(u.err)
+	}(u.done)
+
+	return pr, nil
+}
+
+// close stops streaming and waits for the file not to be read anymore.
+// It returns the error of streaming, e.g. ErrFileTooLarge.
+func (u *multipartUpload) close() error {
+	if u.pr == nil {
+		return nil
+	}
+
+	u.pr.Close()
+	<-u.done
+
+	// the body closed before it is read to the end is not the failure of streaming.
+	if u.err == io.ErrClosedPipe {
+		return nil
+	}
+
+	return u.err
+}
+
+func (u *multipartUpload) write(w io.Writer) error {
+	mw := u.writer(w)
+
+	part, err := mw.CreateFormFile("file", u.filename)
+	if err != nil {
+		return err
+	}
+
+	r := u.file
+	if u.maxSize > 0 {
+		// one byte more than allowed is read to detect the excess.
+		r = io.LimitReader(r, u.maxSize+1)
+	}
+
+	// the pipe blocks until the written bytes are read by the HTTP client, so they are reported as sent.
+	n, err := io.Copy(&progressWriter{w: part, total: u.size, fn: u.progress}, r)
+	if err != nil {
+		return err
+	}
+
+	if u.maxSize > 0 && n > u.maxSize {
+		return ErrFileTooLarge
+	}
+
+	return mw.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressWriter reports the number of bytes written to the function if it is not nil.
+type progressWriter struct {
+	w     io.Writer
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 && w.fn != nil {
+		w.sent += int64(n)
+		w.fn(w.sent, w.total)
+	}
+
+	return n, err
+}
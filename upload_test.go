@@ -0,0 +1,229 @@
+package icqbotapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"icqbotapi/icqtest"
+	"icqbotapi/voice"
+)
+
+func newUploadTestBot(opts ...Option) (*Bot, *icqtest.Server) {
+	srv := icqtest.NewServer()
+
+	return newServerTestBot(srv, opts...), srv
+}
+
+// newServerTestBot creates another bot calling the test server.
+func newServerTestBot(srv *icqtest.Server, opts ...Option) *Bot {
+	return NewWithOptions(srv.Token, append([]Option{
+		WithBaseURL(srv.URL()),
+		WithHTTPClient(srv.Client()),
+		WithRetryPolicy(NoRetry),
+		WithLogger(NopLogger),
+	}, opts...)...)
+}
+
+func newFileRequest(file io.Reader) *SendNewFileRequest {
+	return NewSendNewFileRequest("chat1", file, "video.mp4")
+}
+
+// onlyReader hides io.Seeker of the reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestBot_SendNewFileStreaming(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+
+	tests := []struct {
+		name      string
+		file      io.Reader
+		wantTotal int64
+	}{
+		{name: "seekable", file: bytes.NewReader(content), wantTotal: int64(len(content))},
+		{name: "not seekable", file: onlyReader{bytes.NewReader(content)}, wantTotal: -1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bot, srv := newUploadTestBot()
+			defer srv.Close()
+
+			var sent, total int64
+
+			req := newFileRequest(tt.file)
+			req.Progress = func(s, t int64) {
+				sent, total = s, t
+			}
+
+			resp, err := bot.SendNewFile(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f, _ := srv.File(resp.FileID); !bytes.Equal(f.Content, content) {
+				t.Fatalf("unexpected content of %d bytes", len(f.Content))
+			}
+
+			if sent != int64(len(content)) || total != tt.wantTotal {
+				t.Fatalf("unexpected progress: %d/%d", sent, total)
+			}
+
+			r := srv.RequestsTo("/messages/sendFile")[0]
+			contentLength := r.Header.Get("Content-Length")
+
+			if tt.wantTotal < 0 && contentLength != "" {
+				t.Fatalf("unexpected Content-Length: %s", contentLength)
+			}
+
+			if tt.wantTotal >= 0 && contentLength != strconv.Itoa(len(r.Body)) {
+				t.Fatalf("unexpected Content-Length: %s", contentLength)
+			}
+		})
+	}
+}
+
+func TestBot_SendNewFileMaxSize(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 1000)
+
+	bot, srv := newUploadTestBot(WithMaxUploadSize(999))
+	defer srv.Close()
+
+	if _, err := bot.SendNewFile(context.Background(), newFileRequest(bytes.NewReader(content))); err != ErrFileTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := len(srv.Requests()); n != 0 {
+		t.Fatalf("seekable file is not checked before upload: %d requests", n)
+	}
+
+	if _, err := bot.SendNewFile(context.Background(), newFileRequest(onlyReader{bytes.NewReader(content)})); err != ErrFileTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bot = newServerTestBot(srv, WithMaxUploadSize(1000))
+
+	if _, err := bot.SendNewFile(context.Background(), newFileRequest(onlyReader{bytes.NewReader(content)})); err != nil {
+		t.Fatalf("file of the maximum size is not uploaded: %v", err)
+	}
+}
+
+func TestBot_SendNewFileRetry(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	bot, srv := newUploadTestBot(WithRetryPolicy(testRetryPolicy))
+	defer srv.Close()
+
+	srv.Fail("/messages/sendFile", icqtest.Failure{StatusCode: http.StatusServiceUnavailable})
+
+	file := bytes.NewReader(content)
+	// the upload starts from the current offset of the file.
+	_, _ = file.Seek(10, io.SeekStart)
+
+	resp, err := bot.SendNewFile(context.Background(), newFileRequest(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, _ := srv.File(resp.FileID); !bytes.Equal(f.Content, content[10:]) {
+		t.Fatalf("unexpected content of %d bytes", len(f.Content))
+	}
+
+	if n := len(srv.RequestsTo("/messages/sendFile")); n != 2 {
+		t.Fatalf("unexpected number of attempts: %d", n)
+	}
+}
+
+func TestBot_SendNewFileVoiceCheck(t *testing.T) {
+	content := []byte("ID3 not an OGG file")
+
+	bot, srv := newUploadTestBot()
+	defer srv.Close()
+
+	req := newFileRequest(bytes.NewReader(content))
+	req.IsVoice = true
+
+	if _, err := bot.SendNewFile(context.Background(), req); !errors.Is(err, voice.ErrInvalidVoice) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := len(srv.Requests()); n != 0 {
+		t.Fatalf("invalid voice is sent: %d requests", n)
+	}
+
+	req.SkipVoiceCheck = true
+
+	resp, err := bot.SendNewFile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unchecked voice is not sent: %v", err)
+	}
+
+	if resp.Voice != nil {
+		t.Fatalf("unexpected voice info: %+v", resp.Voice)
+	}
+
+	// the file which cannot be inspected without buffering is sent unchecked.
+	req = newFileRequest(onlyReader{bytes.NewReader(content)})
+	req.IsVoice = true
+
+	if _, err := bot.SendNewFile(context.Background(), req); err != nil {
+		t.Fatalf("not seekable voice is not sent: %v", err)
+	}
+
+	if n := len(srv.RequestsTo("/messages/sendVoice")); n != 2 {
+		t.Fatalf("unexpected number of voice requests: %d", n)
+	}
+}
+
+func TestBot_SendNewFileFromPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icqbotapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pepe.jpg")
+	if err := ioutil.WriteFile(path, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bot, srv := newUploadTestBot()
+	defer srv.Close()
+
+	req := NewSendLocalFileRequest("chat1", path)
+	req.Caption = "it's pepe"
+	req.ReplyMessageID = 42
+
+	resp, err := bot.SendNewFile(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, _ := srv.File(resp.FileID); string(f.Content) != "content" || f.Filename != "pepe.jpg" {
+		t.Fatalf("unexpected file: %+v", f)
+	}
+
+	q := srv.Messages("chat1")[0].Query
+	if q.Get("caption") != "it's pepe" || q.Get("replyMsgId") != "42" || q["text"] != nil {
+		t.Fatalf("unexpected query: %v", q)
+	}
+
+	if req.File != nil || req.Filename != "" {
+		t.Fatalf("request is modified: %+v", req)
+	}
+
+	if _, err := bot.SendNewFile(context.Background(), NewSendLocalFileRequest("chat1", filepath.Join(dir, "missing"))); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
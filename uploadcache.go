@@ -0,0 +1,175 @@
+package icqbotapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// UploadCache maps hashes of uploaded content to IDs of files on the server.
+type UploadCache interface {
+	// Get returns the ID of the file with the content hash or the empty string if there is none.
+	Get(ctx context.Context, hash string) (string, error)
+	// Set saves the ID of the file with the content hash.
+	Set(ctx context.Context, hash, fileID string) error
+	// Delete deletes the ID of the file with the content hash.
+	Delete(ctx context.Context, hash string) error
+}
+
+// MemoryUploadCache is the UploadCache which keeps file IDs in memory.
+type MemoryUploadCache struct {
+	mu      sync.Mutex
+	fileIDs map[string]string
+}
+
+// NewMemoryUploadCache creates the in-memory upload cache.
+func NewMemoryUploadCache() *MemoryUploadCache {
+	return &MemoryUploadCache{
+		fileIDs: make(map[string]string),
+	}
+}
+
+// Get returns the ID of the file with the content hash.
+func (c *MemoryUploadCache) Get(_ context.Context, hash string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.fileIDs[hash], nil
+}
+
+// Set saves the ID of the file with the content hash.
+func (c *MemoryUploadCache) Set(_ context.Context, hash, fileID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fileIDs[hash] = fileID
+
+	return nil
+}
+
+// Delete deletes the ID of the file with the content hash.
+func (c *MemoryUploadCache) Delete(_ context.Context, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.fileIDs, hash)
+
+	return nil
+}
+
+type kvUploadCache struct {
+	kv     KeyValueStore
+	prefix string
+}
+
+// NewKVUploadCache creates the upload cache which keeps file IDs in the key-value storage
+// under keys made of the prefix and the content hash.
+func NewKVUploadCache(kv KeyValueStore, prefix string) UploadCache {
+	return &kvUploadCache{
+		kv:     kv,
+		prefix: prefix,
+	}
+}
+
+func (c *kvUploadCache) Get(ctx context.Context, hash string) (string, error) {
+	p, err := c.kv.Get(ctx, c.prefix+hash)
+	return string(p), err
+}
+
+func (c *kvUploadCache) Set(ctx context.Context, hash, fileID string) error {
+	return c.kv.Set(ctx, c.prefix+hash, []byte(fileID))
+}
+
+// Delete sets the empty file ID, since KeyValueStore cannot delete keys.
+func (c *kvUploadCache) Delete(ctx context.Context, hash string) error {
+	return c.kv.Set(ctx, c.prefix+hash, nil)
+}
+
+// WithUploadCache makes SendNewFile send files uploaded before by their IDs instead of uploading them again.
+// Files are identified by the SHA-256 hash of the content. Only files which are io.Seeker are looked up,
+// since the content is hashed before sending. The cached ID is deleted if the server reports it unknown.
+func WithUploadCache(c UploadCache) Option {
+	return func(b *Bot) {
+		b.uploadCache = c
+	}
+}
+
+// hashContent returns the hex-encoded SHA-256 hash of the content of the seekable file
+// from its current offset. The file is rewound to the offset.
+// It returns the empty string if the file cannot seek, e.g. it is the pipe.
+func hashContent(f io.ReadSeeker) (string, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sendCachedFile sends the file uploaded before by its ID if the content hash is cached.
+// It returns nil response if the file must be uploaded.
+func (b *Bot) sendCachedFile(ctx context.Context, r *SendNewFileRequest, hash string) (*SendNewFileResponse, error) {
+	fileID, err := b.uploadCache.Get(ctx, hash)
+	if err != nil {
+		b.logUploadCacheError(err)
+		return nil, nil
+	}
+
+	if fileID == "" {
+		return nil, nil
+	}
+
+	resp, err := b.SendFile(ctx, &SendFileRequest{
+		FileMessage: r.FileMessage,
+		FileID:      fileID,
+	})
+
+	if isUnknownFileError(err) {
+		// the file has expired on the server, so it is uploaded again.
+		if err := b.uploadCache.Delete(ctx, hash); err != nil {
+			b.logUploadCacheError(err)
+		}
+
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendNewFileResponse{
+		StatusMessageIDResponse: *resp,
+		FileID:                  fileID,
+	}, nil
+}
+
+// isUnknownFileError reports whether the server does not know the file ID.
+// Other errors, e.g. about the missing chat, do not invalidate the cached ID.
+func isUnknownFileError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	d := strings.ToLower(apiErr.Description)
+
+	return strings.Contains(d, "file") && (strings.Contains(d, "not found") || strings.Contains(d, "invalid"))
+}
+
+// logUploadCacheError logs the failure of the upload cache, which does not fail sending the file.
+func (b *Bot) logUploadCacheError(err error) {
+	b.logger.Log(LogLevelWarn, "upload cache failed", LogField{LogKeyError, err})
+}
@@ -0,0 +1,146 @@
+package icqbotapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"icqbotapi/icqtest"
+)
+
+func TestBot_SendNewFileUploadCache(t *testing.T) {
+	cache := NewMemoryUploadCache()
+
+	bot, srv := newUploadTestBot(WithUploadCache(cache))
+	defer srv.Close()
+
+	ctx := context.Background()
+	content := []byte("logo")
+
+	first, err := bot.SendNewFile(ctx, newFileRequest(bytes.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := bot.SendNewFile(ctx, newFileRequest(bytes.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.FileID != first.FileID || second.MessageID == first.MessageID {
+		t.Fatalf("unexpected response: %+v", second)
+	}
+
+	uploads := 0
+
+	for _, r := range srv.RequestsTo("/messages/sendFile") {
+		if r.HTTPMethod == http.MethodPost {
+			uploads++
+		} else if r.Query.Get("fileId") != first.FileID {
+			t.Fatalf("unexpected file ID: %s", r.Query.Get("fileId"))
+		}
+	}
+
+	if uploads != 1 {
+		t.Fatalf("unexpected number of uploads: %d", uploads)
+	}
+
+	// the file which is not seekable is always uploaded.
+	if _, err := bot.SendNewFile(ctx, newFileRequest(onlyReader{bytes.NewReader(content)})); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(srv.RequestsTo("/messages/sendFile")); n != 3 {
+		t.Fatalf("unexpected number of requests: %d", n)
+	}
+}
+
+func TestBot_SendNewFileUploadCacheInvalidation(t *testing.T) {
+	kv := mapKeyValueStore{}
+
+	bot, srv := newUploadTestBot(WithUploadCache(NewKVUploadCache(kv, "upload:")))
+	defer srv.Close()
+
+	ctx := context.Background()
+	content := []byte("template")
+
+	hash, err := hashContent(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv["upload:"+hash] = []byte("expired")
+
+	resp, err := bot.SendNewFile(ctx, newFileRequest(bytes.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, _ := srv.File(resp.FileID); !bytes.Equal(f.Content, content) {
+		t.Fatalf("file is not uploaded again: %+v", resp)
+	}
+
+	if string(kv["upload:"+hash]) != resp.FileID {
+		t.Fatalf("cache is not updated: %s", kv["upload:"+hash])
+	}
+}
+
+func TestBot_SendNewFileUploadCacheOtherErrors(t *testing.T) {
+	cache := NewMemoryUploadCache()
+
+	bot, srv := newUploadTestBot(WithUploadCache(cache))
+	defer srv.Close()
+
+	ctx := context.Background()
+	content := []byte("logo")
+
+	first, err := bot.SendNewFile(ctx, newFileRequest(bytes.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Fail("/messages/sendFile", icqtest.Failure{Description: "Chat not found"})
+
+	if _, err := bot.SendNewFile(ctx, newFileRequest(bytes.NewReader(content))); !IsNotFound(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hash, _ := hashContent(bytes.NewReader(content))
+	if fileID, _ := cache.Get(ctx, hash); fileID != first.FileID {
+		t.Fatalf("cached file ID is invalidated: %q", fileID)
+	}
+
+	if n := len(srv.RequestsTo("/messages/sendFile")); n != 2 {
+		t.Fatalf("file is uploaded again: %d requests", n)
+	}
+}
+
+// readCountingFile counts reads of the file.
+type readCountingFile struct {
+	*bytes.Reader
+	reads int
+}
+
+func (f *readCountingFile) Read(p []byte) (int, error) {
+	f.reads++
+	return f.Reader.Read(p)
+}
+
+func TestBot_SendNewFileUploadCacheMaxSize(t *testing.T) {
+	bot, srv := newUploadTestBot(WithUploadCache(NewMemoryUploadCache()), WithMaxUploadSize(3))
+	defer srv.Close()
+
+	file := &readCountingFile{Reader: bytes.NewReader([]byte("logo"))}
+
+	req := newFileRequest(file)
+	req.IsVoice = true
+
+	if _, err := bot.SendNewFile(context.Background(), req); err != ErrFileTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if file.reads != 0 {
+		t.Fatalf("too large file is read %d times", file.reads)
+	}
+}
@@ -0,0 +1,133 @@
+package voice
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	pageHeaderSize = 27
+	// pageBOS is the header type flag of the first page of the stream.
+	pageBOS = 0x02
+)
+
+// page represents the OGG page.
+type page struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+	body       []byte
+}
+
+// firstPacket returns the first packet of the page, which may be incomplete if it continues on the next page.
+func (p *page) firstPacket() []byte {
+	n := 0
+
+	for _, s := range p.segments {
+		n += int(s)
+		if s < 255 {
+			break
+		}
+	}
+
+	return p.body[:n]
+}
+
+// readPage reads the page verifying its checksum. It returns io.EOF if there are no more pages.
+func readPage(r *bufio.Reader) (*page, error) {
+	header := make([]byte, pageHeaderSize)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			return nil, formatError("the OGG page is truncated")
+		}
+
+		return nil, err
+	}
+
+	if string(header[:4]) != "OggS" {
+		return nil, formatError("the file is not OGG")
+	}
+
+	if header[4] != 0 {
+		return nil, formatError("unsupported OGG version")
+	}
+
+	p := &page{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		segments:   make([]byte, header[26]),
+	}
+
+	if _, err := io.ReadFull(r, p.segments); err != nil {
+		return nil, truncated(err)
+	}
+
+	n := 0
+	for _, s := range p.segments {
+		n += int(s)
+	}
+
+	p.body = make([]byte, n)
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, truncated(err)
+	}
+
+	checksum := binary.LittleEndian.Uint32(header[22:26])
+	// the checksum is computed with the checksum field zeroed.
+	copy(header[22:26], []byte{0, 0, 0, 0})
+
+	crc := oggCRC(0, header)
+	crc = oggCRC(crc, p.segments)
+	crc = oggCRC(crc, p.body)
+
+	if crc != checksum {
+		return nil, formatError("the OGG page checksum mismatch")
+	}
+
+	return p, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return formatError("the OGG page is truncated")
+	}
+
+	return err
+}
+
+// crcTable is the table of the CRC-32 with the polynomial 0x04c11db7 used by OGG, which is not reflected.
+var crcTable = func() [256]uint32 {
+	var t [256]uint32
+
+	for i := range t {
+		r := uint32(i) << 24
+
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+
+		t[i] = r
+	}
+
+	return t
+}()
+
+func oggCRC(crc uint32, p []byte) uint32 {
+	for _, b := range p {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+
+	return crc
+}
@@ -0,0 +1,163 @@
+// Package voice inspects OGG/Opus files, so they are played by clients as voice messages.
+package voice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidVoice is matched by errors about files which would be shown by clients as generic attachments.
+var ErrInvalidVoice = errors.New("invalid voice message")
+
+// FormatError describes why the file is not the valid voice message.
+type FormatError struct {
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return "invalid voice message: " + e.Reason
+}
+
+// Is makes errors.Is(err, ErrInvalidVoice) match.
+func (e *FormatError) Is(target error) bool {
+	return target == ErrInvalidVoice
+}
+
+func formatError(reason string) error {
+	return &FormatError{Reason: reason}
+}
+
+// opusSampleRate is the rate of granule positions of Opus streams.
+const opusSampleRate = 48000
+
+// Info represents properties of the Opus stream.
+type Info struct {
+	Channels int
+	// InputSampleRate is the sample rate of the original audio, which is informational only.
+	InputSampleRate uint32
+	// PreSkip is the number of samples to skip at the start of the decoded audio.
+	PreSkip uint16
+	// MappingFamily is the channel mapping family, which is 0 for mono and stereo streams.
+	MappingFamily byte
+	Duration      time.Duration
+}
+
+// Inspect reads the OGG container to the end and returns properties of its first Opus stream.
+// It returns *FormatError if the file is not the valid OGG/Opus file.
+func Inspect(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		info    *Info
+		serial  uint32
+		granule int64 = -1
+	)
+
+	for {
+		p, err := readPage(br)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if info == nil {
+			if p.headerType&pageBOS == 0 {
+				return nil, formatError("the first OGG page does not begin the stream")
+			}
+
+			if info, err = parseOpusHead(p.firstPacket()); err != nil {
+				return nil, err
+			}
+
+			serial = p.serial
+
+			continue
+		}
+
+		// pages of other multiplexed streams are skipped, as well as pages without finished packets.
+		if p.serial == serial && p.granule != -1 {
+			granule = p.granule
+		}
+	}
+
+	if info == nil {
+		return nil, formatError("the file is empty")
+	}
+
+	if samples := granule - int64(info.PreSkip); samples > 0 {
+		info.Duration = time.Duration(samples) * time.Second / opusSampleRate
+	}
+
+	return info, nil
+}
+
+// Validate checks that the Opus stream is played by clients as the voice message.
+// It returns *FormatError describing the first problem found.
+func Validate(info *Info) error {
+	if info.MappingFamily != 0 || info.Channels < 1 || info.Channels > 2 {
+		return formatError("the stream has " + strconv.Itoa(info.Channels) +
+			" channels, only mono and stereo are supported")
+	}
+
+	if info.Duration <= 0 {
+		return formatError("the stream has no audio")
+	}
+
+	return nil
+}
+
+// InspectAndValidate inspects the seekable file from its current offset and rewinds it back.
+// It returns *FormatError if the file would be shown as the generic attachment.
+func InspectAndValidate(f io.ReadSeeker) (*Info, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := Inspect(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func parseOpusHead(p []byte) (*Info, error) {
+	const headSize = 19
+
+	if !bytes.HasPrefix(p, []byte("OpusHead")) {
+		return nil, formatError("the stream is not Opus")
+	}
+
+	if len(p) < headSize {
+		return nil, formatError("the Opus header is truncated")
+	}
+
+	// the major version must be 0, minor versions are compatible.
+	if p[8]>>4 != 0 {
+		return nil, formatError("unsupported Opus version " + strconv.Itoa(int(p[8])))
+	}
+
+	return &Info{
+		Channels:        int(p[9]),
+		PreSkip:         binary.LittleEndian.Uint16(p[10:12]),
+		InputSampleRate: binary.LittleEndian.Uint32(p[12:16]),
+		MappingFamily:   p[18],
+	}, nil
+}
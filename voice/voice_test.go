@@ -0,0 +1,135 @@
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// testPage encodes the OGG page with the single packet of less than 255 bytes.
+func testPage(headerType byte, granule int64, serial uint32, packet []byte) []byte {
+	p := make([]byte, pageHeaderSize, pageHeaderSize+1+len(packet))
+	copy(p, "OggS")
+	p[5] = headerType
+	binary.LittleEndian.PutUint64(p[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(p[14:18], serial)
+	p[26] = 1
+	p = append(p, byte(len(packet)))
+	p = append(p, packet...)
+
+	binary.LittleEndian.PutUint32(p[22:26], oggCRC(0, p))
+
+	return p
+}
+
+func opusHead(channels, family byte) []byte {
+	p := make([]byte, 19)
+	copy(p, "OpusHead")
+	p[8], p[9], p[18] = 1, channels, family
+	binary.LittleEndian.PutUint16(p[10:12], 312)
+	binary.LittleEndian.PutUint32(p[12:16], 16000)
+
+	return p
+}
+
+// testOpus encodes the Opus stream of the duration with the page of the other stream in between.
+func testOpus(channels byte, duration time.Duration) []byte {
+	var b bytes.Buffer
+	b.Write(testPage(pageBOS, 0, 1, opusHead(channels, 0)))
+	b.Write(testPage(0, 0, 1, []byte("OpusTags")))
+	b.Write(testPage(pageBOS, 0, 2, []byte("\x01vorbis")))
+	b.Write(testPage(0, 312+int64(duration/time.Second)*48000/2, 1, []byte{0xfc}))
+	b.Write(testPage(0, -1, 1, []byte{0xfc}))
+	b.Write(testPage(0, 1<<40, 2, []byte{0}))
+	b.Write(testPage(0x04, 312+int64(duration/time.Second)*48000, 1, []byte{0xfc}))
+
+	return b.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	info, err := Inspect(bytes.NewReader(testOpus(1, 3*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Info{Channels: 1, InputSampleRate: 16000, PreSkip: 312, Duration: 3 * time.Second}
+	if *info != want {
+		t.Fatalf("unexpected info: %+v", *info)
+	}
+}
+
+func TestInspect_Invalid(t *testing.T) {
+	valid := testOpus(1, time.Second)
+
+	corrupted := append([]byte(nil), valid...)
+	corrupted[len(corrupted)-1]++
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "empty", file: nil},
+		{name: "not ogg", file: []byte("ID3\x03\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+		{name: "vorbis", file: testPage(pageBOS, 0, 1, []byte("\x01vorbis"))},
+		{name: "truncated head", file: testPage(pageBOS, 0, 1, []byte("OpusHead\x01\x01"))},
+		{name: "no bos", file: testPage(0, 0, 1, opusHead(1, 0))},
+		{name: "truncated page", file: valid[:len(valid)-1]},
+		{name: "checksum", file: corrupted},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Inspect(bytes.NewReader(tt.file))
+
+			var fe *FormatError
+			if !errors.As(err, &fe) || !errors.Is(err, ErrInvalidVoice) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    Info
+		wantErr bool
+	}{
+		{name: "mono", info: Info{Channels: 1, Duration: time.Second}},
+		{name: "stereo", info: Info{Channels: 2, Duration: time.Second}},
+		{name: "surround", info: Info{Channels: 6, MappingFamily: 1, Duration: time.Second}, wantErr: true},
+		{name: "no channels", info: Info{Duration: time.Second}, wantErr: true},
+		{name: "no audio", info: Info{Channels: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(&tt.info); (err != nil) != tt.wantErr || err != nil && !errors.Is(err, ErrInvalidVoice) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestInspectAndValidate(t *testing.T) {
+	file := bytes.NewReader(append([]byte("prefix"), testOpus(2, 2*time.Second)...))
+	_, _ = file.Seek(6, io.SeekStart)
+
+	info, err := InspectAndValidate(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Duration != 2*time.Second || info.Channels != 2 {
+		t.Fatalf("unexpected info: %+v", *info)
+	}
+
+	if offset, _ := file.Seek(0, io.SeekCurrent); offset != 6 {
+		t.Fatalf("file is not rewound: %d", offset)
+	}
+}
@@ -0,0 +1,167 @@
+package icqbotapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/mailru/easyjson"
+
+	"icqbotapi/event"
+)
+
+const (
+	// WebhookSecretHeader is the header of pushed requests carrying the shared secret.
+	WebhookSecretHeader = "X-Bot-Webhook-Secret"
+
+	maxWebhookBodySize   = 10 << 20
+	webhookDedupCapacity = 4096
+)
+
+//easyjson:json
+// webhookRequest represents the pushed events, either as PollResponse or as the single event.
+type webhookRequest struct {
+	Events  []event.Event   `json:"events"`
+	EventID int             `json:"eventId"`
+	Type    event.Kind      `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// WithWebhook makes the bot receive events pushed to WebhookHandler instead of polling.
+// Pushed requests must carry the secret in WebhookSecretHeader. All requests are rejected if the secret is empty.
+func WithWebhook(secret string) Option {
+	return func(b *Bot) {
+		b.webhookMode = true
+		b.webhook.secret = secret
+	}
+}
+
+// webhookInbox passes events pushed to the webhook to the dispatcher of the running bot.
+type webhookInbox struct {
+	secret string
+
+	mu     sync.RWMutex
+	ctx    context.Context
+	events chan<- event.Event
+
+	seenMu sync.Mutex
+	seen   map[int]bool
+	order  []int
+}
+
+// receive makes the inbox pass events to the channel until the context is done.
+func (w *webhookInbox) receive(ctx context.Context, events chan<- event.Event) {
+	w.mu.Lock()
+	w.ctx = ctx
+	w.events = events
+	w.mu.Unlock()
+
+	<-ctx.Done()
+
+	// the lock waits for in-flight requests, so the channel is not closed while they send.
+	w.mu.Lock()
+	w.ctx = nil
+	w.events = nil
+	w.mu.Unlock()
+
+	close(events)
+}
+
+// markSeen marks the event as received. It returns false if the event has already been received.
+// Events without ID are never deduplicated.
+func (w *webhookInbox) markSeen(eventID int) bool {
+	if eventID == 0 {
+		return true
+	}
+
+	w.seenMu.Lock()
+	defer w.seenMu.Unlock()
+
+	if w.seen == nil {
+		w.seen = make(map[int]bool)
+	}
+
+	if w.seen[eventID] {
+		return false
+	}
+
+	if len(w.order) >= webhookDedupCapacity {
+		delete(w.seen, w.order[0])
+		w.order = w.order[1:]
+	}
+
+	w.seen[eventID] = true
+	w.order = append(w.order, eventID)
+
+	return true
+}
+
+// unmarkSeen forgets the event which has not been passed to the dispatcher, so it is accepted if pushed again.
+func (w *webhookInbox) unmarkSeen(eventID int) {
+	w.seenMu.Lock()
+	defer w.seenMu.Unlock()
+
+	delete(w.seen, eventID)
+}
+
+func (w *webhookInbox) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the empty secret would authenticate requests without the header.
+	if w.secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(WebhookSecretHeader)), []byte(w.secret)) != 1 {
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	req := &webhookRequest{}
+	if err := easyjson.UnmarshalFromReader(http.MaxBytesReader(rw, r.Body, maxWebhookBodySize), req); err != nil {
+		http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	events := req.Events
+	if req.Type != "" {
+		events = append(events, event.Event{EventID: req.EventID, Type: req.Type, Payload: req.Payload})
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.events == nil {
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	for _, ev := range events {
+		if !w.markSeen(ev.EventID) {
+			continue
+		}
+
+		select {
+		case w.events <- ev:
+		case <-w.ctx.Done():
+			w.unmarkSeen(ev.EventID)
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+			return
+		case <-r.Context().Done():
+			w.unmarkSeen(ev.EventID)
+			return
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write([]byte(`{"ok":true}`))
+}
+
+// WebhookHandler returns the handler of events pushed to the bot configured WithWebhook.
+// Events are deduplicated by ID and passed to the same dispatcher as polled events.
+// The handler responds with 503 status code while the bot is not running.
+func (b *Bot) WebhookHandler() http.Handler {
+	return &b.webhook
+}
@@ -0,0 +1,144 @@
+package icqbotapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"icqbotapi/event"
+)
+
+func postWebhook(t *testing.T, url, secret, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(WebhookSecretHeader, secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestBot_WebhookHandler(t *testing.T) {
+	bot := NewWithOptions("token", WithWebhook("secret"), WithLogger(NopLogger))
+
+	srv := httptest.NewServer(bot.WebhookHandler())
+	defer srv.Close()
+
+	if code := postWebhook(t, srv.URL, "secret", testNewMessageEvent); code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code of stopped bot: %d", code)
+	}
+
+	var handled int32
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		atomic.AddInt32(&handled, 1)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.HandleEvents(ctx)
+
+	if code := postWebhook(t, srv.URL, "wrong", testNewMessageEvent); code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code of wrong secret: %d", code)
+	}
+
+	for code := 0; code != http.StatusOK; {
+		code = postWebhook(t, srv.URL, "secret", `{"events": [`+testNewMessageEvent+`]}`)
+	}
+
+	// the duplicate is skipped.
+	if code := postWebhook(t, srv.URL, "secret", testNewMessageEvent); code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+
+	// events without ID are not deduplicated.
+	noID := `{"type": "newMessage", "payload": {"msgId": "2", "chat": {"chatId": "chat1"}}}`
+	for i := 0; i < 2; i++ {
+		if code := postWebhook(t, srv.URL, "secret", noID); code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := bot.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != 3 {
+		t.Fatalf("unexpected number of handled events: %d", handled)
+	}
+}
+
+func TestBot_WebhookHandlerEmptySecret(t *testing.T) {
+	bot := NewWithOptions("token", WithWebhook(""), WithLogger(NopLogger))
+
+	srv := httptest.NewServer(bot.WebhookHandler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.HandleEvents(ctx)
+
+	code := postWebhook(t, srv.URL, "", testNewMessageEvent)
+
+	cancel()
+	_ = bot.Wait()
+
+	if code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code of empty secret: %d", code)
+	}
+}
+
+func TestBot_WebhookOffsets(t *testing.T) {
+	offsets := NewMemoryOffsetStore()
+	_ = offsets.Commit(context.Background(), 42)
+
+	bot := NewWithOptions("token", WithWebhook("secret"), WithLogger(NopLogger), WithOffsetStore(offsets))
+
+	srv := httptest.NewServer(bot.WebhookHandler())
+	defer srv.Close()
+
+	var handled int32
+	bot.SetNewMessageHandler(func(e event.NewMessagePayload) {
+		atomic.AddInt32(&handled, 1)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.HandleEvents(ctx)
+
+	payload := `"type": "newMessage", "payload": {"msgId": "1", "chat": {"chatId": "chat1"}}`
+
+	// the event without ID and the event pushed out of order do not move the offset back.
+	for _, body := range []string{`{"eventId": 50, ` + payload + `}`, `{` + payload + `}`, `{"eventId": 45, ` + payload + `}`} {
+		for code := 0; code != http.StatusOK; {
+			code = postWebhook(t, srv.URL, "secret", body)
+		}
+	}
+
+	for atomic.LoadInt32(&handled) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	if err := bot.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := offsets.Load(context.Background()); id != 50 {
+		t.Fatalf("unexpected committed offset: %d", id)
+	}
+}